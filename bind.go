@@ -0,0 +1,92 @@
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+)
+
+const (
+	// clientCertKey is the reserved store key holding the bound client certificate fingerprint
+	clientCertKey = "_session.client_cert"
+	// fingerprintKey is the reserved store key holding the hash of the bound Config.Fingerprint
+	fingerprintKey = "_session.fingerprint"
+)
+
+// clientCertFingerprint returns the hex encoded SHA-256 of the client's leaf certificate,
+// or an empty string if the request carries no client certificate
+func clientCertFingerprint(req *http.Request) string {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256(req.TLS.PeerCertificates[0].Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientFingerprint returns a fingerprint of the client made of its User-Agent and network,
+// the /24 of IPv4 addresses and the /48 of IPv6 ones, for use as Config.Fingerprint.
+// The address is taken from req.RemoteAddr, behind a proxy it is the proxy's unless
+// RemoteAddr is rewritten from the forwarded headers beforehand
+func ClientFingerprint(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+
+	network := host
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			network = ip4.Mask(net.CIDRMask(24, 32)).String()
+		} else {
+			network = ip.Mask(net.CIDRMask(48, 128)).String()
+		}
+	}
+
+	return network + " " + req.UserAgent()
+}
+
+// requestFingerprint returns the hex encoded SHA-256 of the Config.Fingerprint of req
+func (s *Session) requestFingerprint(req *http.Request) string {
+	sum := sha256.Sum256([]byte(s.config.Fingerprint(req)))
+	return hex.EncodeToString(sum[:])
+}
+
+// bind records the request attributes a new session is bound to
+func (s *Session) bind(req *http.Request) {
+	if s.config.BindClientCert {
+		if fp := clientCertFingerprint(req); fp != "" {
+			s.store.Set(clientCertKey, fp)
+		}
+	}
+
+	if s.config.Fingerprint != nil {
+		s.store.Set(fingerprintKey, s.requestFingerprint(req))
+	}
+}
+
+// verifyBindings reports whether the request matches the attributes the session is bound to.
+// A session without a fingerprint yet, e.g. created before Config.Fingerprint was set, is bound now,
+// unless it was started read-only
+func (s *Session) verifyBindings(req *http.Request) bool {
+	if s.config.BindClientCert {
+		if bound, ok := s.store.Get(clientCertKey); ok && bound != clientCertFingerprint(req) {
+			return false
+		}
+	}
+
+	if s.config.Fingerprint != nil {
+		fp := s.requestFingerprint(req)
+		bound, ok := s.store.Get(fingerprintKey)
+		if !ok {
+			if !s.readOnly {
+				s.store.Set(fingerprintKey, fp)
+			}
+		} else if bound != fp {
+			return false
+		}
+	}
+
+	return true
+}
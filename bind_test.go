@@ -0,0 +1,83 @@
+package session
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFingerprintBinding(t *testing.T) {
+	m := newTestManager(t, nil, func(cfg *Config) { cfg.Fingerprint = ClientFingerprint })
+
+	rs, w := startRequest(m)
+	cookie := responseCookie(w, "sid")
+
+	same, _ := startRequest(m, cookie)
+	if same.ID() != rs.ID() {
+		t.Errorf("the same client got session %q, want %q", same.ID(), rs.ID())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "another client")
+	req.AddCookie(cookie)
+	if other := m.Start(httptest.NewRecorder(), req); other.ID() == rs.ID() {
+		t.Error("another client was handed the session")
+	}
+}
+
+func TestStartReadOnlyDoesNotBind(t *testing.T) {
+	provider := NewMemoryProvider()
+	rs, w := startRequest(newTestManager(t, provider, nil))
+	if err := rs.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	// the fingerprint is enabled after the session was created
+	m := newTestManager(t, provider, func(cfg *Config) { cfg.Fingerprint = ClientFingerprint })
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(responseCookie(w, "sid"))
+
+	ro := m.StartReadOnly(req)
+	if ro.ID() != rs.ID() {
+		t.Fatalf("read-only session %q, want %q", ro.ID(), rs.ID())
+	}
+	if rs.store.Has(fingerprintKey) {
+		t.Error("the read-only start bound the session")
+	}
+}
+
+// tlsRequest returns a request presenting a client certificate of raw bytes cert, none if empty
+func tlsRequest(cert string, cookies ...*http.Cookie) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/", nil)
+	req.TLS = &tls.ConnectionState{}
+	if cert != "" {
+		req.TLS.PeerCertificates = []*x509.Certificate{{Raw: []byte(cert)}}
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	return req
+}
+
+func TestClientCertBinding(t *testing.T) {
+	m := newTestManager(t, nil, func(cfg *Config) { cfg.BindClientCert = true })
+
+	w := httptest.NewRecorder()
+	rs := m.Start(w, tlsRequest("certificate A"))
+	rs.Set("user_id", 42)
+	cookie := responseCookie(w, "sid")
+
+	if same := m.Start(httptest.NewRecorder(), tlsRequest("certificate A", cookie)); same.ID() != rs.ID() {
+		t.Errorf("the same certificate got session %q, want %q", same.ID(), rs.ID())
+	}
+
+	for name, cert := range map[string]string{"another certificate": "certificate B", "no certificate": ""} {
+		other := m.Start(httptest.NewRecorder(), tlsRequest(cert, cookie))
+		if other.ID() == rs.ID() || other.Has("user_id") {
+			t.Errorf("%s was handed the session", name)
+		}
+	}
+}
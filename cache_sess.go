@@ -0,0 +1,316 @@
+package session
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+type (
+	// CachingProvider keeps a bounded LRU of recently read stores in front of another provider.
+	//
+	// Stores are returned as handed out by the wrapped provider, and saved by it.
+	// The optional interfaces are forwarded when the wrapped provider implements them,
+	// contexts when it is a ContextProvider, see NewCachingProvider for those that are
+	// only implemented then. Regenerate, Destroy and Expire drop the cached entry.
+	// A cached store may be up to ttl stale with regard to changes made by other
+	// processes; deployments that broadcast session changes over pub/sub should
+	// call Invalidate from their subscriber to evict the entry immediately
+	CachingProvider struct {
+		provider   Provider
+		maxEntries int
+		ttl        time.Duration
+		lru        *list.List
+		entries    map[string]*list.Element
+		sync.Mutex
+	}
+
+	cacheEntry struct {
+		sid      string
+		store    Store
+		cachedAt time.Time
+	}
+
+	// cachingLister is a CachingProvider over a Lister
+	cachingLister struct {
+		*CachingProvider
+	}
+
+	// cachingBulkDestroyer is a CachingProvider over a BulkDestroyer
+	cachingBulkDestroyer struct {
+		*CachingProvider
+	}
+
+	// cachingListerBulkDestroyer is a CachingProvider over a Lister and BulkDestroyer
+	cachingListerBulkDestroyer struct {
+		*CachingProvider
+	}
+)
+
+// NewCachingProvider wraps provider with a cache holding at most maxEntries stores for ttl.
+// The returned provider is a *CachingProvider, or embeds one to implement Lister and
+// BulkDestroyer as well when provider does, so that asserting it never finds a capability
+// provider lacks. Reach Invalidate through the Invalidator interface:
+//
+//	cache := session.NewCachingProvider(provider, 10000, time.Second)
+//	onChange := func(sid string) { cache.(session.Invalidator).Invalidate(sid) }
+func NewCachingProvider(provider Provider, maxEntries int, ttl time.Duration) Provider {
+	c := newCachingProvider(provider, maxEntries, ttl)
+
+	_, lister := provider.(Lister)
+	_, bulk := provider.(BulkDestroyer)
+	switch {
+	case lister && bulk:
+		return cachingListerBulkDestroyer{c}
+	case lister:
+		return cachingLister{c}
+	case bulk:
+		return cachingBulkDestroyer{c}
+	}
+
+	return c
+}
+
+func newCachingProvider(provider Provider, maxEntries int, ttl time.Duration) *CachingProvider {
+	return &CachingProvider{
+		provider:   provider,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Read returns the cached store for sid, reading it from the wrapped provider on a miss
+func (c *CachingProvider) Read(sid string, maxAge int64) Store {
+	return c.ReadContext(context.Background(), sid, maxAge)
+}
+
+// ReadContext is Read passing ctx to the wrapped provider on a miss
+func (c *CachingProvider) ReadContext(ctx context.Context, sid string, maxAge int64) Store {
+	if store, ok := c.get(sid); ok {
+		return store
+	}
+
+	var store Store
+	if cp, ok := c.provider.(ContextProvider); ok {
+		store = cp.ReadContext(ctx, sid, maxAge)
+	} else {
+		store = c.provider.Read(sid, maxAge)
+	}
+
+	c.add(sid, store)
+	return store
+}
+
+// Initialize creates a store through the wrapped provider and caches it
+func (c *CachingProvider) Initialize(sid string, maxAge int64) Store {
+	return c.InitializeContext(context.Background(), sid, maxAge)
+}
+
+// InitializeContext is Initialize passing ctx to the wrapped provider
+func (c *CachingProvider) InitializeContext(ctx context.Context, sid string, maxAge int64) Store {
+	var store Store
+	if cp, ok := c.provider.(ContextProvider); ok {
+		store = cp.InitializeContext(ctx, sid, maxAge)
+	} else {
+		store = c.provider.Initialize(sid, maxAge)
+	}
+
+	c.add(sid, store)
+	return store
+}
+
+// Exists checks the cache, then the wrapped provider, for a session with passed id
+func (c *CachingProvider) Exists(sid string) bool {
+	return c.ExistsContext(context.Background(), sid)
+}
+
+// ExistsContext is Exists passing ctx to the wrapped provider
+func (c *CachingProvider) ExistsContext(ctx context.Context, sid string) bool {
+	if _, ok := c.get(sid); ok {
+		return true
+	}
+
+	if cp, ok := c.provider.(ContextProvider); ok {
+		return cp.ExistsContext(ctx, sid)
+	}
+
+	return c.provider.Exists(sid)
+}
+
+// Regenerate forwards to the wrapped provider and caches the store under its new id
+func (c *CachingProvider) Regenerate(oldsid string, sid string) Store {
+	return c.RegenerateContext(context.Background(), oldsid, sid)
+}
+
+// RegenerateContext is Regenerate passing ctx to the wrapped provider
+func (c *CachingProvider) RegenerateContext(ctx context.Context, oldsid string, sid string) Store {
+	c.Invalidate(oldsid)
+
+	var store Store
+	if cp, ok := c.provider.(ContextProvider); ok {
+		store = cp.RegenerateContext(ctx, oldsid, sid)
+	} else {
+		store = c.provider.Regenerate(oldsid, sid)
+	}
+
+	c.add(sid, store)
+	return store
+}
+
+// Save forwards to the wrapped provider
+func (c *CachingProvider) Save(store Store) error {
+	return c.SaveContext(context.Background(), store)
+}
+
+// SaveContext is Save passing ctx to the wrapped provider
+func (c *CachingProvider) SaveContext(ctx context.Context, store Store) error {
+	if cp, ok := c.provider.(ContextProvider); ok {
+		return cp.SaveContext(ctx, store)
+	}
+
+	return c.provider.Save(store)
+}
+
+// Flush forwards to the wrapped provider if it implements Flusher
+func (c *CachingProvider) Flush() error {
+	if flusher, ok := c.provider.(Flusher); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
+
+// Touch forwards to the wrapped provider if it implements Toucher
+func (c *CachingProvider) Touch(sid string, maxAge int64) {
+	if toucher, ok := c.provider.(Toucher); ok {
+		toucher.Touch(sid, maxAge)
+	}
+}
+
+// Destroy evicts the session from the cache and destroys it in the wrapped provider
+func (c *CachingProvider) Destroy(sid string) {
+	c.DestroyContext(context.Background(), sid)
+}
+
+// DestroyContext is Destroy passing ctx to the wrapped provider
+func (c *CachingProvider) DestroyContext(ctx context.Context, sid string) {
+	c.Invalidate(sid)
+
+	if cp, ok := c.provider.(ContextProvider); ok {
+		cp.DestroyContext(ctx, sid)
+		return
+	}
+
+	c.provider.Destroy(sid)
+}
+
+// Expire evicts the session from the cache and expires it in the wrapped provider,
+// destroying it if the provider does not implement Expirer
+func (c *CachingProvider) Expire(sid string) {
+	c.Invalidate(sid)
+
+	if expirer, ok := c.provider.(Expirer); ok {
+		expirer.Expire(sid)
+		return
+	}
+
+	c.provider.Destroy(sid)
+}
+
+// ListSessions forwards to the wrapped provider
+func (c cachingLister) ListSessions(offset, limit int) ([]SessionInfo, int) {
+	return c.provider.(Lister).ListSessions(offset, limit)
+}
+
+// StartGC forwards to the wrapped provider if it implements GarbageCollector
+func (c *CachingProvider) StartGC(interval time.Duration) {
+	if gc, ok := c.provider.(GarbageCollector); ok {
+		gc.StartGC(interval)
+	}
+}
+
+// StopGC forwards to the wrapped provider if it implements GarbageCollector
+func (c *CachingProvider) StopGC() {
+	if gc, ok := c.provider.(GarbageCollector); ok {
+		gc.StopGC()
+	}
+}
+
+// ListSessions forwards to the wrapped provider
+func (c cachingListerBulkDestroyer) ListSessions(offset, limit int) ([]SessionInfo, int) {
+	return cachingLister(c).ListSessions(offset, limit)
+}
+
+// DestroyWhere forwards to the wrapped provider, evicting the destroyed sessions from the cache
+func (c cachingListerBulkDestroyer) DestroyWhere(fn func(store Store) bool) {
+	cachingBulkDestroyer(c).DestroyWhere(fn)
+}
+
+// DestroyWhere forwards to the wrapped provider, evicting the destroyed sessions from the cache
+func (c cachingBulkDestroyer) DestroyWhere(fn func(store Store) bool) {
+	var sids []string
+	c.provider.(BulkDestroyer).DestroyWhere(func(store Store) bool {
+		if fn(store) {
+			sids = append(sids, store.ID())
+			return true
+		}
+		return false
+	})
+
+	for _, sid := range sids {
+		c.Invalidate(sid)
+	}
+}
+
+// Invalidate evicts the session with passed id from the cache
+func (c *CachingProvider) Invalidate(sid string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if el, ok := c.entries[sid]; ok {
+		c.lru.Remove(el)
+		delete(c.entries, sid)
+	}
+}
+
+func (c *CachingProvider) get(sid string) (Store, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	el, ok := c.entries[sid]
+	if !ok {
+		return nil, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if time.Since(entry.cachedAt) > c.ttl {
+		c.lru.Remove(el)
+		delete(c.entries, sid)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(el)
+	return entry.store, true
+}
+
+func (c *CachingProvider) add(sid string, store Store) {
+	c.Lock()
+	defer c.Unlock()
+
+	if el, ok := c.entries[sid]; ok {
+		el.Value = &cacheEntry{sid: sid, store: store, cachedAt: time.Now()}
+		c.lru.MoveToFront(el)
+		return
+	}
+
+	c.entries[sid] = c.lru.PushFront(&cacheEntry{sid: sid, store: store, cachedAt: time.Now()})
+
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		el := c.lru.Back()
+		c.lru.Remove(el)
+		delete(c.entries, el.Value.(*cacheEntry).sid)
+	}
+}
@@ -0,0 +1,199 @@
+package session
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// contextRecorder is a ContextProvider over a memory provider recording the contexts it is passed
+type contextRecorder struct {
+	*MemorySessionProvider
+	ctxs []context.Context
+}
+
+func (r *contextRecorder) ReadContext(ctx context.Context, sid string, maxAge int64) Store {
+	r.ctxs = append(r.ctxs, ctx)
+	return r.Read(sid, maxAge)
+}
+
+func (r *contextRecorder) InitializeContext(ctx context.Context, sid string, maxAge int64) Store {
+	r.ctxs = append(r.ctxs, ctx)
+	return r.Initialize(sid, maxAge)
+}
+
+func (r *contextRecorder) ExistsContext(ctx context.Context, sid string) bool {
+	r.ctxs = append(r.ctxs, ctx)
+	return r.Exists(sid)
+}
+
+func (r *contextRecorder) RegenerateContext(ctx context.Context, oldsid string, sid string) Store {
+	r.ctxs = append(r.ctxs, ctx)
+	return r.Regenerate(oldsid, sid)
+}
+
+func (r *contextRecorder) DestroyContext(ctx context.Context, sid string) {
+	r.ctxs = append(r.ctxs, ctx)
+	r.Destroy(sid)
+}
+
+func (r *contextRecorder) SaveContext(ctx context.Context, store Store) error {
+	r.ctxs = append(r.ctxs, ctx)
+	return r.Save(store)
+}
+
+type ctxKey struct{}
+
+func TestCachingProviderForwardsContexts(t *testing.T) {
+	inner := &contextRecorder{MemorySessionProvider: NewMemoryProvider()}
+	c := newCachingProvider(inner, 10, time.Minute)
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	store := c.InitializeContext(ctx, "sid1", 3600)
+	c.SaveContext(ctx, store)
+	c.Invalidate("sid1")
+	c.ReadContext(ctx, "sid1", 3600)
+	c.ExistsContext(ctx, "missing")
+	c.RegenerateContext(ctx, "sid1", "sid2")
+	c.DestroyContext(ctx, "sid2")
+
+	if len(inner.ctxs) != 6 {
+		t.Fatalf("the wrapped provider was passed %d contexts, want 6", len(inner.ctxs))
+	}
+	for i, got := range inner.ctxs {
+		if got.Value(ctxKey{}) != "request" {
+			t.Errorf("call %d was not passed the request context", i)
+		}
+	}
+}
+
+func TestCachingProviderForwardsOptionalInterfaces(t *testing.T) {
+	inner := NewMemoryProvider()
+	c := newCachingProvider(inner, 10, time.Minute)
+
+	store := c.Initialize("sid1", 3600)
+	store.Set("user_id", 42)
+	c.Initialize("sid2", 3600)
+
+	if _, total := (cachingLister{c}).ListSessions(0, 10); total != 2 {
+		t.Errorf("ListSessions total = %d, want 2", total)
+	}
+
+	c.Expire("sid1")
+	if c.Read("sid1", 3600).Has("user_id") {
+		t.Error("Read after Expire returned the cached store")
+	}
+
+	var p Provider = c
+	if _, ok := p.(GarbageCollector); !ok {
+		t.Error("CachingProvider does not forward GarbageCollector")
+	}
+}
+
+func TestCachingProviderCapabilitiesOnlyWhenWrapped(t *testing.T) {
+	redis := NewCachingProvider(NewRedisProvider(newFakeRedis(), nil), 10, time.Minute)
+	if _, ok := redis.(BulkDestroyer); ok {
+		t.Error("caching a provider without BulkDestroyer implements it")
+	}
+	if _, ok := redis.(Lister); ok {
+		t.Error("caching a provider without Lister implements it")
+	}
+
+	inner := NewMemoryProvider()
+	c := NewCachingProvider(inner, 10, time.Minute)
+	bd, ok := c.(BulkDestroyer)
+	if !ok {
+		t.Fatal("caching a BulkDestroyer does not implement it")
+	}
+
+	c.Initialize("sid1", 3600).Set("user_id", 42)
+	c.Initialize("sid2", 3600)
+	bd.DestroyWhere(func(store Store) bool { return store.Has("user_id") })
+	if inner.Exists("sid1") || c.Exists("sid1") {
+		t.Error("the matching session survived DestroyWhere")
+	}
+	if _, total := c.(Lister).ListSessions(0, 10); total != 1 {
+		t.Errorf("ListSessions total = %d, want 1", total)
+	}
+	if !inner.Exists("sid2") {
+		t.Error("DestroyWhere destroyed a session not matching")
+	}
+
+	if _, ok := c.(Invalidator); !ok {
+		t.Error("the caching provider does not implement Invalidator")
+	}
+}
+
+// countingProvider counts the reads reaching a memory provider
+type countingProvider struct {
+	*MemorySessionProvider
+	reads int
+}
+
+func (p *countingProvider) Read(sid string, maxAge int64) Store {
+	p.reads++
+	return p.MemorySessionProvider.Read(sid, maxAge)
+}
+
+func TestCachingProviderHitsAndMisses(t *testing.T) {
+	inner := &countingProvider{MemorySessionProvider: NewMemoryProvider()}
+	c := newCachingProvider(inner, 2, time.Minute)
+	for _, sid := range []string{"sid1", "sid2", "sid3"} {
+		inner.Initialize(sid, 3600)
+	}
+
+	first := c.Read("sid1", 3600)
+	if c.Read("sid1", 3600) != first || inner.reads != 1 {
+		t.Errorf("second read reached the provider, %d reads", inner.reads)
+	}
+
+	c.Read("sid2", 3600)
+	c.Read("sid3", 3600)
+	if c.Read("sid1", 3600); inner.reads != 4 {
+		t.Errorf("%d reads, want the least recently used sid1 evicted and read again", inner.reads)
+	}
+
+	c.Invalidate("sid1")
+	if c.Read("sid1", 3600); inner.reads != 5 {
+		t.Errorf("%d reads, want sid1 read again once invalidated", inner.reads)
+	}
+}
+
+func TestCachingProviderTTL(t *testing.T) {
+	inner := &countingProvider{MemorySessionProvider: NewMemoryProvider()}
+	c := newCachingProvider(inner, 10, 10*time.Millisecond)
+	inner.Initialize("sid1", 3600)
+
+	c.Read("sid1", 3600)
+	time.Sleep(20 * time.Millisecond)
+	if c.Read("sid1", 3600); inner.reads != 2 {
+		t.Errorf("%d reads, want the stale entry read again", inner.reads)
+	}
+}
+
+func TestCachingProviderWritesInvalidate(t *testing.T) {
+	inner := NewMemoryProvider()
+	c := newCachingProvider(inner, 10, time.Minute)
+
+	store := c.Initialize("sid1", 3600)
+	store.Set("user_id", 42)
+
+	moved := c.Regenerate("sid1", "sid2")
+	if c.Exists("sid1") {
+		t.Error("the old id is still cached after Regenerate")
+	}
+	if data, _ := c.Read("sid2", 3600).Get("user_id"); data != 42 || c.Read("sid2", 3600) != moved {
+		t.Errorf("user_id = %v under the new id, want the moved store", data)
+	}
+
+	c.Destroy("sid2")
+	if _, ok := c.get("sid2"); ok || c.Exists("sid2") {
+		t.Error("the destroyed session is still cached")
+	}
+
+	c.Initialize("sid3", 3600).Set("user_id", 42)
+	cachingBulkDestroyer{c}.DestroyWhere(func(store Store) bool { return store.Has("user_id") })
+	if _, ok := c.get("sid3"); ok {
+		t.Error("the session destroyed by DestroyWhere is still cached")
+	}
+}
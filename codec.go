@@ -0,0 +1,248 @@
+package session
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"log"
+)
+
+// ErrDecrypt is returned when an encrypted session fails authentication with every key.
+// Providers treat such sessions as missing and start a fresh one
+var ErrDecrypt = errors.New("session: session payload failed decryption")
+
+type (
+	// Codec serializes session values for providers storing them outside the process.
+	// GobCodec and JSONCodec serialize the values, other codecs compose them, e.g.
+	// an EncryptedCodec wrapping the JSONCodec
+	Codec interface {
+		Marshal(values map[string]interface{}) ([]byte, error)
+		Unmarshal(data []byte) (map[string]interface{}, error)
+	}
+
+	// GobCodec serializes session values with gob behind the format version byte,
+	// see RegisterUpgrader. Providers use it when no Codec is configured
+	GobCodec struct{}
+
+	// EncryptedCodec encrypts the output of another codec with AES-GCM, so session
+	// values are unreadable and tamper-proof in the backend. The first key encrypts,
+	// every key is tried to decrypt, which allows rotating keys: prepend the new key,
+	// and drop the old one once sessions written with it have expired.
+	//
+	//	codec, err := session.NewEncryptedCodec(nil, newKey, oldKey)
+	//	if err != nil {
+	//		log.Fatal(err)
+	//	}
+	//	provider := session.NewRedisProvider(client, &session.RedisOptions{Codec: codec})
+	EncryptedCodec struct {
+		codec Codec
+		aeads []cipher.AEAD
+	}
+
+	// CompressedCodec gzips the output of another codec when it is larger than a threshold.
+	// Smaller payloads are stored as produced by the wrapped codec, compressed ones are
+	// a gzip stream, recognized on Unmarshal by the gzip magic bytes 0x1f 0x8b:
+	//
+	//	len(data) <= threshold: data
+	//	len(data) >  threshold: 0x1f 0x8b ... gzip(data)
+	//
+	// so sessions saved before compression was enabled still read. To combine it with
+	// encryption, compress first, encrypted data does not compress:
+	//
+	//	codec, err := session.NewEncryptedCodec(session.NewCompressedCodec(nil, 2048), key)
+	CompressedCodec struct {
+		codec     Codec
+		threshold int
+	}
+)
+
+// defaultCodec is used by providers configured without a Codec
+var defaultCodec Codec = GobCodec{}
+
+// Marshal serializes values with gob
+func (GobCodec) Marshal(values map[string]interface{}) ([]byte, error) {
+	return encodeValues(values)
+}
+
+// Unmarshal deserializes values produced by Marshal
+func (GobCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	return decodeValues(data)
+}
+
+// NewEncryptedCodec returns a codec encrypting the output of codec with keys, which must be
+// 16, 24 or 32 bytes long to select AES-128, AES-192 or AES-256. codec may be nil to use gob
+func NewEncryptedCodec(codec Codec, keys ...[]byte) (*EncryptedCodec, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("session: EncryptedCodec requires at least one key")
+	}
+
+	if codec == nil {
+		codec = defaultCodec
+	}
+
+	c := &EncryptedCodec{codec: codec}
+	for _, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+
+		c.aeads = append(c.aeads, aead)
+	}
+
+	return c, nil
+}
+
+// Marshal serializes values and encrypts them with the first key, behind a random nonce
+func (c *EncryptedCodec) Marshal(values map[string]interface{}) ([]byte, error) {
+	data, err := c.codec.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+
+	aead := c.aeads[0]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := io.ReadFull(RandReader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// Unmarshal decrypts data with the first key it authenticates with and deserializes it.
+// returns ErrDecrypt if no key does
+func (c *EncryptedCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	for _, aead := range c.aeads {
+		if len(data) < aead.NonceSize() {
+			continue
+		}
+
+		nonce, sealed := data[:aead.NonceSize()], data[aead.NonceSize():]
+		plain, err := aead.Open(nil, nonce, sealed, nil)
+		if err != nil {
+			continue
+		}
+
+		return c.codec.Unmarshal(plain)
+	}
+
+	return nil, ErrDecrypt
+}
+
+// NewCompressedCodec returns a codec compressing the output of codec when it exceeds
+// threshold bytes, 1024 if threshold is not positive. codec may be nil to use gob
+func NewCompressedCodec(codec Codec, threshold int) *CompressedCodec {
+	if codec == nil {
+		codec = defaultCodec
+	}
+	if threshold <= 0 {
+		threshold = 1024
+	}
+
+	return &CompressedCodec{codec: codec, threshold: threshold}
+}
+
+// Marshal serializes values, gzipping them above the threshold
+func (c *CompressedCodec) Marshal(values map[string]interface{}) ([]byte, error) {
+	data, err := c.codec.Marshal(values)
+	if err != nil || len(data) <= c.threshold {
+		return data, err
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decompresses data if it is a gzip stream and deserializes it
+func (c *CompressedCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	if len(data) < 2 || data[0] != 0x1f || data[1] != 0x8b {
+		return c.codec.Unmarshal(data)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return c.codec.Unmarshal(data)
+	}
+
+	plain, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.codec.Unmarshal(plain)
+}
+
+// SerializationPolicy decides what happens to a session holding a value its codec can not
+// serialize, e.g. a type not registered with RegisterType, see NewPolicyCodec
+type SerializationPolicy int
+
+const (
+	// FailSave fails the whole save: the store stays dirty and the backend keeps the last
+	// session saved successfully. Codecs behave this way unless wrapped by NewPolicyCodec
+	FailSave SerializationPolicy = iota
+	// SkipValue saves the session without the values that can not be serialized,
+	// logging a warning for each. They are gone once the session is read back
+	SkipValue
+)
+
+// PolicyCodec applies a SerializationPolicy to the values another codec fails to serialize
+type PolicyCodec struct {
+	codec  Codec
+	policy SerializationPolicy
+}
+
+// NewPolicyCodec returns a codec serializing values with codec, nil to use gob, and applying
+// policy to the values it can not serialize. With other codecs wrapping it, it must be the
+// innermost one:
+//
+//	codec := session.NewPolicyCodec(session.JSONCodec{}, session.SkipValue)
+//	provider := session.NewRedisProvider(client, &session.RedisOptions{Codec: codec})
+func NewPolicyCodec(codec Codec, policy SerializationPolicy) *PolicyCodec {
+	if codec == nil {
+		codec = defaultCodec
+	}
+
+	return &PolicyCodec{codec: codec, policy: policy}
+}
+
+// Marshal serializes values. If that fails and the policy is SkipValue, each value is
+// serialized on its own to find those failing, which are left out
+func (c *PolicyCodec) Marshal(values map[string]interface{}) ([]byte, error) {
+	data, err := c.codec.Marshal(values)
+	if err == nil || c.policy != SkipValue {
+		return data, err
+	}
+
+	kept := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		if _, err := c.codec.Marshal(map[string]interface{}{key: value}); err != nil {
+			log.Printf("session: skipping %q, it can not be serialized: %v", key, err)
+			continue
+		}
+
+		kept[key] = value
+	}
+
+	return c.codec.Marshal(kept)
+}
+
+// Unmarshal deserializes values with the wrapped codec
+func (c *PolicyCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	return c.codec.Unmarshal(data)
+}
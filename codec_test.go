@@ -0,0 +1,75 @@
+package session
+
+import "testing"
+
+// unregistered is a type never registered with RegisterType, which gob can not serialize
+type unregistered struct {
+	Name string
+}
+
+func TestSerializationPolicy(t *testing.T) {
+	for name, codec := range map[string]Codec{"gob": GobCodec{}, "json": JSONCodec{}} {
+		values := map[string]interface{}{
+			"user_id": 42,
+			"locale":  "fr",
+			"bad":     make(chan int),
+		}
+
+		t.Run(name+"/fail", func(t *testing.T) {
+			dir := t.TempDir()
+			p := NewFileProviderWithOptions(dir, &FileOptions{Codec: NewPolicyCodec(codec, FailSave)})
+			store := p.Initialize("sid1", 3600)
+			store.SetMany(values)
+
+			if err := p.Save(store); err == nil {
+				t.Fatal("Save succeeded with a value that can not be serialized")
+			}
+			if NewFileProviderWithOptions(dir, &FileOptions{Codec: codec}).Read("sid1", 3600).Has("user_id") {
+				t.Error("the failed save was written")
+			}
+		})
+
+		t.Run(name+"/skip", func(t *testing.T) {
+			dir := t.TempDir()
+			p := NewFileProviderWithOptions(dir, &FileOptions{Codec: NewPolicyCodec(codec, SkipValue)})
+			store := p.Initialize("sid1", 3600)
+			store.SetMany(values)
+
+			if err := p.Save(store); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			reloaded := NewFileProviderWithOptions(dir, &FileOptions{Codec: codec}).Read("sid1", 3600)
+			if data, _ := reloaded.Get("locale"); data != "fr" {
+				t.Errorf("locale = %v after reload, want fr", data)
+			}
+			if !reloaded.Has("user_id") {
+				t.Error("user_id was not saved")
+			}
+			if reloaded.Has("bad") {
+				t.Error("the value that can not be serialized was saved")
+			}
+		})
+	}
+}
+
+func TestSerializationPolicyUnregisteredType(t *testing.T) {
+	values := map[string]interface{}{"user_id": 42, "user": unregistered{Name: "ada"}}
+
+	if _, err := NewPolicyCodec(nil, FailSave).Marshal(values); err == nil {
+		t.Error("FailSave serialized an unregistered type")
+	}
+
+	data, err := NewPolicyCodec(nil, SkipValue).Marshal(values)
+	if err != nil {
+		t.Fatalf("SkipValue: %v", err)
+	}
+
+	decoded, err := GobCodec{}.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if len(decoded) != 1 || decoded["user_id"] != 42 {
+		t.Errorf("decoded %v, want only user_id", decoded)
+	}
+}
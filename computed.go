@@ -0,0 +1,68 @@
+package session
+
+import (
+	"sync"
+	"time"
+)
+
+// computedValue is a session item recomputed on read once it is older than ttl
+type computedValue struct {
+	ttl        time.Duration
+	compute    func() interface{}
+	value      interface{}
+	computedAt time.Time
+	computed   bool
+	// now returns the current time, time.Now if nil
+	now func() time.Time
+	sync.Mutex
+}
+
+// SetComputed stores an item whose value is produced by compute.
+// Get returns the cached value while it is younger than ttl, otherwise compute is
+// called again and its result cached. Concurrent reads of a stale item wait for a
+// single computation. Computed items hold a function and are not persisted by
+// providers that serialize the session: codecs leave them out, and a session read
+// back from the backend no longer has them
+func (s *Session) SetComputed(key string, ttl time.Duration, compute func() interface{}) {
+	s.Set(key, &computedValue{ttl: ttl, compute: compute})
+}
+
+// persisted returns values without the computed items, which hold a function and are
+// left out when serializing the session. values itself is returned if it holds none
+func persisted(values map[string]interface{}) map[string]interface{} {
+	for _, data := range values {
+		if _, isComputed := data.(*computedValue); !isComputed {
+			continue
+		}
+
+		kept := make(map[string]interface{}, len(values)-1)
+		for key, data := range values {
+			if _, isComputed := data.(*computedValue); !isComputed {
+				kept[key] = data
+			}
+		}
+
+		return kept
+	}
+
+	return values
+}
+
+// get returns the cached value, recomputing it if stale
+func (c *computedValue) get() interface{} {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+
+	if !c.computed || now().Sub(c.computedAt) >= c.ttl {
+		c.value = c.compute()
+		c.computedAt = now()
+		c.computed = true
+	}
+
+	return c.value
+}
@@ -0,0 +1,87 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestComputedItemsAreNotSaved(t *testing.T) {
+	dir := t.TempDir()
+	rs, _ := startRequest(newTestManager(t, NewFileProvider(dir), nil))
+	rs.Set("user_id", 42)
+	rs.SetComputed("greeting", time.Minute, func() interface{} { return "hello" })
+
+	if err := rs.Save(); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if data, _ := rs.Get("greeting"); data != "hello" {
+		t.Errorf("greeting = %v, want hello", data)
+	}
+
+	store := NewFileProvider(dir).Read(rs.ID(), 3600)
+	if data, _ := store.Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v after reload, want 42", data)
+	}
+	if store.Has("greeting") {
+		t.Error("the computed item was saved")
+	}
+}
+
+func TestCodecsSkipComputedItems(t *testing.T) {
+	values := map[string]interface{}{
+		"user_id":  42,
+		"greeting": &computedValue{ttl: time.Minute, compute: func() interface{} { return "hello" }},
+	}
+
+	for name, codec := range map[string]Codec{"gob": GobCodec{}, "json": JSONCodec{}} {
+		data, err := codec.Marshal(values)
+		if err != nil {
+			t.Errorf("%s: Marshal: %v", name, err)
+			continue
+		}
+
+		decoded, err := codec.Unmarshal(data)
+		if err != nil {
+			t.Errorf("%s: Unmarshal: %v", name, err)
+			continue
+		}
+		if _, ok := decoded["greeting"]; ok || len(decoded) != 1 {
+			t.Errorf("%s: decoded %v, want only user_id", name, decoded)
+		}
+	}
+
+	if len(values) != 2 {
+		t.Error("Marshal modified the values")
+	}
+	if size, want := estimateSize(values), estimateSize(map[string]interface{}{"user_id": 42}); size != want {
+		t.Errorf("estimateSize = %d, want %d as without the computed item", size, want)
+	}
+}
+
+func TestComputedItemRecomputedAfterTTL(t *testing.T) {
+	rs, _ := startRequest(newTestManager(t, nil, nil))
+
+	now := time.Unix(1000, 0)
+	calls := 0
+	rs.Set("permissions", &computedValue{
+		ttl:     5 * time.Minute,
+		compute: func() interface{} { calls++; return calls },
+		now:     func() time.Time { return now },
+	})
+
+	for _, step := range []struct {
+		elapsed time.Duration
+		want    int
+	}{
+		{0, 1},
+		{time.Minute, 1},
+		{5*time.Minute - time.Second, 1},
+		{5 * time.Minute, 2},
+		{6 * time.Minute, 2},
+	} {
+		now = time.Unix(1000, 0).Add(step.elapsed)
+		if data, _ := rs.Get("permissions"); data != step.want || calls != step.want {
+			t.Errorf("after %v Get = %v with %d computations, want %d", step.elapsed, data, calls, step.want)
+		}
+	}
+}
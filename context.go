@@ -0,0 +1,108 @@
+package session
+
+import (
+	"context"
+	"time"
+)
+
+// noObserve is returned by observe when no Observer is configured
+var noObserve = func(error) {}
+
+// observe starts timing the provider operation op, the returned func reports it to the Observer
+func (s *Session) observe(op string) func(err error) {
+	observer := s.config.Observer
+	if observer == nil {
+		return noObserve
+	}
+
+	start := time.Now()
+	return func(err error) {
+		observer.ObserveOp(op, time.Since(start), err)
+	}
+}
+
+// context returns the context of the request the session was started for
+func (s *Session) context() context.Context {
+	if s.ctx == nil {
+		return context.Background()
+	}
+
+	return s.ctx
+}
+
+func (s *Session) providerRead(sid string) Store {
+	defer s.observe("read")(nil)
+
+	if cp, ok := s.provider.(ContextProvider); ok {
+		return cp.ReadContext(s.context(), sid, s.config.MaxAge)
+	}
+
+	return s.provider.Read(sid, s.config.MaxAge)
+}
+
+func (s *Session) providerExists(sid string) bool {
+	defer s.observe("exists")(nil)
+
+	if cp, ok := s.provider.(ContextProvider); ok {
+		return cp.ExistsContext(s.context(), sid)
+	}
+
+	return s.provider.Exists(sid)
+}
+
+func (s *Session) providerInitialize(sid string) Store {
+	defer s.observe("initialize")(nil)
+
+	if cp, ok := s.provider.(ContextProvider); ok {
+		return cp.InitializeContext(s.context(), sid, s.config.MaxAge)
+	}
+
+	return s.provider.Initialize(sid, s.config.MaxAge)
+}
+
+func (s *Session) providerRegenerate(oldsid, sid string) Store {
+	defer s.observe("regenerate")(nil)
+
+	if cp, ok := s.provider.(ContextProvider); ok {
+		return cp.RegenerateContext(s.context(), oldsid, sid)
+	}
+	if r, ok := s.provider.(Regenerator); ok {
+		return r.RegenerateWithMaxAge(oldsid, sid, s.config.MaxAge)
+	}
+
+	return s.provider.Regenerate(oldsid, sid)
+}
+
+func (s *Session) providerDestroy(sid string) {
+	defer s.observe("destroy")(nil)
+
+	if cp, ok := s.provider.(ContextProvider); ok {
+		cp.DestroyContext(s.context(), sid)
+		return
+	}
+
+	s.provider.Destroy(sid)
+}
+
+func (s *Session) providerSave(ctx context.Context) (err error) {
+	done := s.observe("save")
+	defer func() { done(err) }()
+
+	if cp, ok := s.provider.(ContextProvider); ok {
+		return cp.SaveContext(ctx, s.store)
+	}
+
+	return s.provider.Save(s.store)
+}
+
+func (s *Session) providerTouch(toucher Toucher) {
+	defer s.observe("touch")(nil)
+
+	toucher.Touch(s.id, s.config.MaxAge)
+}
+
+func (s *Session) providerExpire(expirer Expirer) {
+	defer s.observe("expire")(nil)
+
+	expirer.Expire(s.id)
+}
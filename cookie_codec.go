@@ -0,0 +1,58 @@
+package session
+
+import "net/http"
+
+type (
+	// CookieCodec reads and writes the session cookie, see Config.CookieCodec.
+	// StdCookieCodec is used when none is configured, the gochefcookie package
+	// provides one backed by github.com/gochef/cookie
+	CookieCodec interface {
+		// Read returns the value of the cookie named name sent with r, "" if there is none
+		Read(name string, r *http.Request) string
+		// Write sends the cookie named name with value and the attributes in opts
+		Write(name, value string, opts CookieOptions, w http.ResponseWriter)
+	}
+
+	// CookieOptions are the attributes of the session cookie, taken from the Config.
+	// A MaxAge of 0 omits Max-Age, a negative one sends Max-Age=0 to delete the cookie
+	CookieOptions struct {
+		Path     string
+		Domain   string
+		MaxAge   int
+		Secure   bool
+		HttpOnly bool
+		SameSite http.SameSite
+	}
+
+	// StdCookieCodec reads and writes cookies with net/http
+	StdCookieCodec struct{}
+)
+
+// Cookie returns the http.Cookie named name with value and the attributes in opts
+func (opts CookieOptions) Cookie(name, value string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     opts.Path,
+		Domain:   opts.Domain,
+		MaxAge:   opts.MaxAge,
+		Secure:   opts.Secure,
+		HttpOnly: opts.HttpOnly,
+		SameSite: opts.SameSite,
+	}
+}
+
+// Read returns the value of the cookie named name with r.Cookie
+func (StdCookieCodec) Read(name string, r *http.Request) string {
+	c, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+
+	return c.Value
+}
+
+// Write sends the cookie with http.SetCookie
+func (StdCookieCodec) Write(name, value string, opts CookieOptions, w http.ResponseWriter) {
+	http.SetCookie(w, opts.Cookie(name, value))
+}
@@ -0,0 +1,191 @@
+package session
+
+import (
+	"encoding/base64"
+	"fmt"
+	"time"
+)
+
+const (
+	// cookieIDKey is the reserved key holding the session id inside a cookie payload
+	cookieIDKey = "_session.id"
+	// cookieExpiresKey is the reserved key holding the unix expiry of a cookie payload
+	cookieExpiresKey = "_session.expires"
+	// minCookieSecretLength is the shortest secret NewCookieProvider signs cookies with
+	minCookieSecretLength = 32
+)
+
+// ErrCookieTooLarge is returned when an encoded session exceeds CookieProviderOptions.MaxSize.
+// It wraps ErrSessionTooLarge, which new code should test for
+var ErrCookieTooLarge = fmt.Errorf("%w: encoded session exceeds the cookie size limit", ErrSessionTooLarge)
+
+type (
+	// CookieEncoder is implemented by providers keeping the whole session in the cookie.
+	// Session.Commit uses it to re-issue the cookie with the current values
+	CookieEncoder interface {
+		// EncodeCookie returns the cookie value carrying store, valid for maxAge seconds
+		EncodeCookie(store Store, maxAge int64) (string, error)
+		// Rekey returns a copy of store under a new session id
+		Rekey(store Store, sid string) Store
+	}
+
+	// CookieProvider keeps sessions entirely client side: the values are gob encoded,
+	// signed with HMAC-SHA256 and stored in the cookie value itself, so no state is
+	// kept on the server. The cookie value is the "sid" handed to Read.
+	//
+	// Having no server state, Destroy only relies on the session cookie being expired,
+	// Exists reports whether a cookie value verifies, and Regenerate decodes the passed
+	// cookie value into a store under the new id. Changes are sent to the client by
+	// Session.Commit, which WithSession calls before the response is written
+	CookieProvider struct {
+		signer  Signer
+		codec   Codec
+		maxSize int
+	}
+
+	// CookieProviderOptions configures a CookieProvider
+	CookieProviderOptions struct {
+		// MaxSize is the largest encoded cookie value in bytes, unchecked by the
+		// provider if 0.
+		//
+		// Deprecated: set Config.MaxSize, which Session.Commit enforces
+		MaxSize int
+		// Signer replaces the default HMAC-SHA256 signer
+		Signer Signer
+		// Codec serializes session values, defaults to GobCodec.
+		// Use an EncryptedCodec to hide the session values from the client
+		Codec Codec
+	}
+)
+
+// NewCookieProvider returns a provider signing session cookies with secret.
+// opts may be nil to use the defaults. It panics if secret is shorter than 32 bytes
+// and opts sets no Signer, anyone could forge sessions signed with a short key
+func NewCookieProvider(secret []byte, opts *CookieProviderOptions) *CookieProvider {
+	p := &CookieProvider{
+		codec: defaultCodec,
+	}
+
+	if opts != nil {
+		if opts.MaxSize > 0 {
+			p.maxSize = opts.MaxSize
+		}
+		if opts.Signer != nil {
+			p.signer = opts.Signer
+		}
+		if opts.Codec != nil {
+			p.codec = opts.Codec
+		}
+	}
+
+	if p.signer == nil {
+		if len(secret) < minCookieSecretLength {
+			panic(fmt.Sprintf("session: cookie secret is %d bytes, at least %d are required", len(secret), minCookieSecretLength))
+		}
+		p.signer = NewHMACSigner(secret)
+	}
+
+	return p
+}
+
+// Read decodes the session carried by a cookie value.
+// If the value is tampered with, expired or can not be decoded, a fresh empty store is returned
+func (p *CookieProvider) Read(sid string, maxAge int64) Store {
+	if store, ok := p.decode(sid); ok {
+		return store
+	}
+
+	id, err := randomString(32)
+	if err != nil {
+		id = ""
+	}
+
+	return p.Initialize(id, maxAge)
+}
+
+// Initialize returns an empty store, nothing is kept server side
+func (p *CookieProvider) Initialize(sid string, maxAge int64) Store {
+	return newMemoryStore(sid, make(map[string]interface{}))
+}
+
+// Exists reports whether sid is a cookie value with a valid signature that has not expired
+func (p *CookieProvider) Exists(sid string) bool {
+	_, ok := p.decode(sid)
+	return ok
+}
+
+// Regenerate decodes the session carried by the cookie value oldsid into a store under sid
+func (p *CookieProvider) Regenerate(oldsid string, sid string) Store {
+	store, ok := p.decode(oldsid)
+	if !ok {
+		return p.Initialize(sid, 0)
+	}
+
+	return p.Rekey(store, sid)
+}
+
+// Save is a no-op, Session.Commit sends the values with the cookie
+func (p *CookieProvider) Save(store Store) error {
+	return nil
+}
+
+// Destroy is a no-op, the session disappears with its cookie
+func (p *CookieProvider) Destroy(sid string) {}
+
+// EncodeCookie returns the signed cookie value carrying the store values
+func (p *CookieProvider) EncodeCookie(store Store, maxAge int64) (string, error) {
+	values := store.Snapshot()
+	values[cookieIDKey] = store.ID()
+	if maxAge > 0 {
+		values[cookieExpiresKey] = time.Now().Unix() + maxAge
+	}
+
+	data, err := p.codec.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+
+	value := signValue(p.signer, base64.RawURLEncoding.EncodeToString(data))
+	if p.maxSize > 0 && len(value) > p.maxSize {
+		return "", fmt.Errorf("%w: %d bytes, limit is %d", ErrCookieTooLarge, len(value), p.maxSize)
+	}
+
+	return value, nil
+}
+
+// Rekey returns a copy of store under sid
+func (p *CookieProvider) Rekey(store Store, sid string) Store {
+	return newMemoryStore(sid, store.Snapshot())
+}
+
+// decode verifies and decodes a cookie value produced by EncodeCookie
+func (p *CookieProvider) decode(value string) (*MemorySessionStore, bool) {
+	if p.maxSize > 0 && len(value) > p.maxSize {
+		return nil, false
+	}
+
+	payload, ok := unsignValue(p.signer, value)
+	if !ok {
+		return nil, false
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, false
+	}
+
+	values, err := p.codec.Unmarshal(data)
+	if err != nil {
+		return nil, false
+	}
+
+	if expires, ok := values[cookieExpiresKey].(int64); ok && expires <= time.Now().Unix() {
+		return nil, false
+	}
+
+	id, _ := values[cookieIDKey].(string)
+	delete(values, cookieIDKey)
+	delete(values, cookieExpiresKey)
+
+	return newMemoryStore(id, values), true
+}
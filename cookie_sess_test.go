@@ -0,0 +1,62 @@
+package session
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCookieSizeLimit(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	for name, tc := range map[string]struct {
+		provider *CookieProvider
+		maxSize  int
+		size     int
+		fail     bool
+	}{
+		"default fits":      {NewCookieProvider(secret, nil), 0, 2000, false},
+		"default":           {NewCookieProvider(secret, nil), 0, 5000, true},
+		"maxSize":           {NewCookieProvider(secret, nil), 1000, 1500, true},
+		"maxSize too large": {NewCookieProvider(secret, nil), 8000, 5000, true},
+		"provider maxSize":  {NewCookieProvider(secret, &CookieProviderOptions{MaxSize: 1000}), 0, 1500, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := newTestManager(t, tc.provider, func(cfg *Config) { cfg.MaxSize = tc.maxSize })
+			rs, w := startRequest(m)
+			rs.Set("blob", strings.Repeat("x", tc.size))
+
+			err := rs.Commit(w)
+			if !tc.fail {
+				if err != nil {
+					t.Fatalf("Commit: %v", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrSessionTooLarge) {
+				t.Fatalf("Commit = %v, want ErrSessionTooLarge", err)
+			}
+			if c := responseCookie(w, "sid"); c != nil && len(c.Value) > maxCookieValueLength {
+				t.Errorf("a %d bytes cookie was written", len(c.Value))
+			}
+		})
+	}
+}
+
+func TestNewCookieProviderRejectsShortSecrets(t *testing.T) {
+	for name, secret := range map[string][]byte{"nil": nil, "empty": {}, "short": []byte("0123456789abcdef")} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Error("NewCookieProvider accepted the secret")
+				}
+			}()
+			NewCookieProvider(secret, nil)
+		})
+	}
+
+	if p := NewCookieProvider(nil, &CookieProviderOptions{Signer: NewHMACSigner([]byte("rotated elsewhere"))}); p == nil {
+		t.Error("NewCookieProvider refused a custom Signer")
+	}
+}
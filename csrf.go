@@ -0,0 +1,50 @@
+package session
+
+import "crypto/subtle"
+
+// csrfKey is the reserved store key holding the CSRF token of the session
+const csrfKey = "_session.csrf"
+
+// CSRFToken returns the CSRF token of the session, generating it on first use.
+// Embed it in forms or send it in a header, then check it with ValidateCSRF.
+// The token is rotated whenever the session is regenerated.
+// returns an empty string if the session is destroyed, not started or no token can be generated
+func (s *Session) CSRFToken() string {
+	if !s.writable() {
+		return ""
+	}
+
+	token := s.store.Modify(csrfKey, func(data interface{}, ok bool) interface{} {
+		if token, isString := data.(string); ok && isString && token != "" {
+			return token
+		}
+
+		token, err := randomString(32)
+		if err != nil {
+			s.logf("session: generating CSRF token: %v", err)
+			return ""
+		}
+
+		return token
+	})
+
+	return token.(string)
+}
+
+// ValidateCSRF reports whether token matches the CSRF token of the session, in constant time.
+// returns false if the session has no token yet
+func (s *Session) ValidateCSRF(token string) bool {
+	stored, ok := s.GetString(csrfKey)
+	if !ok || stored == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(token)) == 1
+}
+
+// rotateCSRF drops the CSRF token, CSRFToken generates a new one when next called
+func (s *Session) rotateCSRF() {
+	if s.store.Has(csrfKey) {
+		s.store.Remove(csrfKey)
+	}
+}
@@ -0,0 +1,108 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+// formatVersion is the version of the serialized session format,
+// written as the first byte of every serialized session
+const formatVersion byte = 1
+
+// Upgrader decodes a session serialized in an older format, data excludes the version byte
+type Upgrader func(data []byte) (map[string]interface{}, error)
+
+// ErrUnknownFormat is returned when decoding a serialized session whose
+// format version is neither current nor handled by a registered Upgrader.
+// Providers treat such sessions as missing and start a fresh one
+var ErrUnknownFormat = errors.New("session: unknown serialized session format")
+
+var (
+	upgraders   = map[byte]Upgrader{}
+	upgradersMu sync.RWMutex
+)
+
+// RegisterUpgrader registers the decoder of sessions serialized with format version.
+// panics if version is the current format or already has an upgrader
+func RegisterUpgrader(version byte, upgrader Upgrader) {
+	upgradersMu.Lock()
+	defer upgradersMu.Unlock()
+
+	if _, ok := upgraders[version]; ok || version == formatVersion {
+		panic(fmt.Sprintf("session: Upgrader for format version %d is already registered", version))
+	}
+
+	upgraders[version] = upgrader
+}
+
+func init() {
+	// the type of the reserved items holding expiries, see SetWithTTL and RememberIdempotencyKey
+	RegisterType(map[string]int64(nil))
+	// read by GetTime
+	RegisterType(time.Time{})
+}
+
+// RegisterType records the concrete type of value so that providers serializing sessions
+// with gob can save and load it. Every type stored with Set other than the basic types
+// and their slices, such as structs and maps, must be registered once, e.g. in init:
+//
+//	session.RegisterType(User{})
+//
+// A type controls its own wire format by implementing encoding.BinaryMarshaler and
+// encoding.BinaryUnmarshaler, e.g. to store a field encrypted. Both GobCodec and JSONCodec
+// then save the output of MarshalBinary and read values back with UnmarshalBinary,
+// the codec only framing the bytes. A type must implement both sides: gob writes a type
+// implementing only MarshalBinary in its custom format and then fails to read it back,
+// JSONCodec writes such a type, or one implementing only UnmarshalBinary, as plain JSON
+func RegisterType(value interface{}) {
+	gob.Register(value)
+	registerBinaryType(reflect.TypeOf(value))
+}
+
+// encodeValues serializes session values with gob, behind the format version byte
+func encodeValues(values map[string]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(formatVersion)
+	if err := gob.NewEncoder(&buf).Encode(persisted(values)); err != nil {
+		if strings.Contains(err.Error(), "type not registered") {
+			return nil, fmt.Errorf("%w, register it with session.RegisterType", err)
+		}
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeValues deserializes session values produced by encodeValues,
+// handing sessions in older formats to their registered Upgrader
+func decodeValues(data []byte) (map[string]interface{}, error) {
+	if len(data) == 0 {
+		return nil, ErrUnknownFormat
+	}
+
+	version, data := data[0], data[1:]
+	if version != formatVersion {
+		upgradersMu.RLock()
+		upgrader, ok := upgraders[version]
+		upgradersMu.RUnlock()
+
+		if !ok {
+			return nil, ErrUnknownFormat
+		}
+
+		return upgrader(data)
+	}
+
+	values := make(map[string]interface{})
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&values); err != nil {
+		return nil, err
+	}
+
+	return values, nil
+}
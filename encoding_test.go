@@ -0,0 +1,83 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// legacyVersion is a format version of the tests, its blobs hold "key=int" pairs
+const legacyVersion byte = 200
+
+func init() {
+	RegisterUpgrader(legacyVersion, func(data []byte) (map[string]interface{}, error) {
+		values := make(map[string]interface{})
+		for _, pair := range strings.Split(string(data), ",") {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return nil, errors.New("malformed pair")
+			}
+
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, err
+			}
+			values[key] = n
+		}
+
+		return values, nil
+	})
+}
+
+func TestReadUpgradesOldFormat(t *testing.T) {
+	p := NewFileProvider(t.TempDir())
+	os.WriteFile(p.path("sid1"), append([]byte{legacyVersion}, "user_id=42,visits=3"...), 0600)
+
+	store := p.Read("sid1", 3600)
+	if data, _ := store.Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v, want 42 read through the upgrader", data)
+	}
+	if data, _ := store.Get("visits"); data != 3 {
+		t.Errorf("visits = %v, want 3 read through the upgrader", data)
+	}
+
+	store.Set("locale", "fr")
+	if err := p.Save(store); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	saved, err := os.ReadFile(p.path("sid1"))
+	if err != nil || len(saved) == 0 || saved[0] != formatVersion {
+		t.Errorf("the upgraded session was not saved in the current format")
+	}
+}
+
+func TestReadUnknownFormatStartsFresh(t *testing.T) {
+	p := NewFileProvider(t.TempDir())
+	blob := append([]byte{legacyVersion + 1}, "user_id=42"...)
+	os.WriteFile(p.path("sid1"), blob, 0600)
+
+	if _, err := decodeValues(blob); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("decodeValues = %v, want ErrUnknownFormat", err)
+	}
+
+	store := p.Read("sid1", 3600)
+	if store.Len() != 0 {
+		t.Errorf("the session of unknown format holds %d items, want a fresh one", store.Len())
+	}
+}
+
+func TestRegisterUpgraderTwicePanics(t *testing.T) {
+	for _, version := range []byte{legacyVersion, formatVersion} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registering an Upgrader for version %d did not panic", version)
+				}
+			}()
+			RegisterUpgrader(version, nil)
+		}()
+	}
+}
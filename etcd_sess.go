@@ -0,0 +1,276 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// etcdRegenerateAttempts is how many times Regenerate reads the session again when it
+// changed before the transaction moving it
+const etcdRegenerateAttempts = 3
+
+type (
+	// EtcdProvider stores sessions in etcd, each under its own key attached to a lease
+	// whose TTL is the session max age, so etcd expires idle sessions by itself.
+	// Reading a session refreshes its lease, changes are written in a single PUT when the store is saved
+	EtcdProvider struct {
+		client        *clientv3.Client
+		prefix        string
+		timeout       time.Duration
+		defaultMaxAge int64
+		codec         Codec
+	}
+
+	// EtcdOptions configures an EtcdProvider
+	EtcdOptions struct {
+		// Prefix is prepended to the session id to build keys, defaults to "session/"
+		Prefix string
+		// Timeout bounds every etcd request, defaults to 5 seconds
+		Timeout time.Duration
+		// DefaultMaxAge is the lease TTL in seconds of sessions created by Regenerate
+		// when the old session is gone, defaults to 86400
+		DefaultMaxAge int64
+		// Codec serializes session values, defaults to GobCodec.
+		// Use an EncryptedCodec to encrypt sessions at rest
+		Codec Codec
+	}
+)
+
+// NewEtcdProvider returns a provider storing sessions through client.
+// opts may be nil to use the defaults
+func NewEtcdProvider(client *clientv3.Client, opts *EtcdOptions) *EtcdProvider {
+	p := &EtcdProvider{
+		client:        client,
+		prefix:        "session/",
+		timeout:       5 * time.Second,
+		defaultMaxAge: 86400,
+		codec:         defaultCodec,
+	}
+
+	if opts != nil {
+		if opts.Prefix != "" {
+			p.prefix = opts.Prefix
+		}
+		if opts.Timeout > 0 {
+			p.timeout = opts.Timeout
+		}
+		if opts.DefaultMaxAge > 0 {
+			p.defaultMaxAge = opts.DefaultMaxAge
+		}
+		if opts.Codec != nil {
+			p.codec = opts.Codec
+		}
+	}
+
+	return p
+}
+
+// Read fetches the session from etcd and refreshes its lease.
+// If the session does not exist or can not be decoded or decrypted, a new one is created and returned.
+// If the request fails the error is logged and an empty store is returned that is never saved,
+// leaving the key as is
+func (p *EtcdProvider) Read(sid string, maxAge int64) Store {
+	return p.ReadContext(context.Background(), sid, maxAge)
+}
+
+// ReadContext is like Read, bounding the etcd requests by ctx
+func (p *EtcdProvider) ReadContext(ctx context.Context, sid string, maxAge int64) Store {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	resp, err := p.client.Get(ctx, p.key(sid))
+	if err != nil {
+		// a failing etcd must not wipe the session, only this request goes without it
+		log.Printf("session: reading session: %v", err)
+		return newMemoryStore(sid, make(map[string]interface{}))
+	}
+	if len(resp.Kvs) == 0 {
+		return p.InitializeContext(ctx, sid, maxAge)
+	}
+
+	kv := resp.Kvs[0]
+	values, err := p.codec.Unmarshal(kv.Value)
+	if err != nil {
+		return p.InitializeContext(ctx, sid, maxAge)
+	}
+
+	lease := clientv3.LeaseID(kv.Lease)
+	if lease != clientv3.NoLease {
+		p.client.KeepAliveOnce(ctx, lease)
+	}
+
+	return p.store(sid, values, lease)
+}
+
+// Initialize creates an empty session in etcd under a new lease of maxAge seconds
+func (p *EtcdProvider) Initialize(sid string, maxAge int64) Store {
+	return p.InitializeContext(context.Background(), sid, maxAge)
+}
+
+// InitializeContext is like Initialize, bounding the etcd requests by ctx
+func (p *EtcdProvider) InitializeContext(ctx context.Context, sid string, maxAge int64) Store {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	lease := clientv3.NoLease
+	if maxAge > 0 {
+		if resp, err := p.client.Grant(ctx, maxAge); err == nil {
+			lease = resp.ID
+		}
+	}
+
+	store := p.store(sid, make(map[string]interface{}), lease)
+	store.create(ctx)
+	return store
+}
+
+// Exists checks if a session with passed id exists
+func (p *EtcdProvider) Exists(sid string) bool {
+	return p.ExistsContext(context.Background(), sid)
+}
+
+// ExistsContext is like Exists, bounding the etcd requests by ctx
+func (p *EtcdProvider) ExistsContext(ctx context.Context, sid string) bool {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	resp, err := p.client.Get(ctx, p.key(sid), clientv3.WithCountOnly())
+	return err == nil && resp.Count > 0
+}
+
+// Regenerate moves the session to the new id in a single transaction, keeping its lease.
+// If the transaction fails the error is logged, the old key deleted and the values read
+// put under the new id
+func (p *EtcdProvider) Regenerate(oldsid string, sid string) Store {
+	return p.RegenerateContext(context.Background(), oldsid, sid)
+}
+
+// RegenerateContext is like Regenerate, bounding the etcd requests by ctx
+func (p *EtcdProvider) RegenerateContext(ctx context.Context, oldsid string, sid string) Store {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	oldKey, newKey := p.key(oldsid), p.key(sid)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := p.client.Get(ctx, oldKey)
+		if err != nil {
+			// the old id must not stay usable, Session carries the values over
+			log.Printf("session: reading session: %v", err)
+			p.client.Delete(ctx, oldKey)
+			return p.InitializeContext(ctx, sid, p.defaultMaxAge)
+		}
+		if len(resp.Kvs) == 0 {
+			return p.InitializeContext(ctx, sid, p.defaultMaxAge)
+		}
+
+		kv := resp.Kvs[0]
+		values, err := p.codec.Unmarshal(kv.Value)
+		if err != nil {
+			p.client.Delete(ctx, oldKey)
+			return p.InitializeContext(ctx, sid, p.defaultMaxAge)
+		}
+
+		lease := clientv3.LeaseID(kv.Lease)
+		txn, err := p.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(oldKey), "=", kv.ModRevision)).
+			Then(
+				clientv3.OpPut(newKey, string(kv.Value), clientv3.WithLease(lease)),
+				clientv3.OpDelete(oldKey),
+			).
+			Commit()
+		if err == nil && txn.Succeeded {
+			return p.store(sid, values, lease)
+		}
+		if err == nil && attempt < etcdRegenerateAttempts {
+			continue // the session changed since it was read
+		}
+
+		if err == nil {
+			err = fmt.Errorf("session %q kept changing", oldsid)
+		}
+		log.Printf("session: moving session: %v", err)
+		p.client.Delete(ctx, oldKey)
+
+		store := p.store(sid, values, lease)
+		store.create(ctx)
+		return store
+	}
+}
+
+// Save writes the store to etcd if it changed since it was read or last saved
+func (p *EtcdProvider) Save(store Store) error {
+	return p.SaveContext(context.Background(), store)
+}
+
+// SaveContext is like Save, bounding the etcd requests by ctx
+func (p *EtcdProvider) SaveContext(ctx context.Context, store Store) error {
+	return saveSynced(ctx, store)
+}
+
+// Touch refreshes the lease of the session
+func (p *EtcdProvider) Touch(sid string, maxAge int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	resp, err := p.client.Get(ctx, p.key(sid))
+	if err == nil && len(resp.Kvs) > 0 && resp.Kvs[0].Lease != 0 {
+		p.client.KeepAliveOnce(ctx, clientv3.LeaseID(resp.Kvs[0].Lease))
+	}
+}
+
+// Destroy deletes the session and revokes its lease
+func (p *EtcdProvider) Destroy(sid string) {
+	p.DestroyContext(context.Background(), sid)
+}
+
+// DestroyContext is like Destroy, bounding the etcd requests by ctx
+func (p *EtcdProvider) DestroyContext(ctx context.Context, sid string) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	resp, err := p.client.Get(ctx, p.key(sid))
+	if err == nil && len(resp.Kvs) > 0 && resp.Kvs[0].Lease != 0 {
+		p.client.Revoke(ctx, clientv3.LeaseID(resp.Kvs[0].Lease))
+	}
+
+	p.client.Delete(ctx, p.key(sid))
+}
+
+// store returns a store saving its values to the key of sid under lease.
+// Only creating the session puts a missing key, saving never recreates a key destroyed meanwhile
+func (p *EtcdProvider) store(sid string, values map[string]interface{}, lease clientv3.LeaseID) *syncedStore {
+	return newSyncedStore(sid, values, func(ctx context.Context, values map[string]interface{}, create bool) error {
+		data, err := p.codec.Marshal(values)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+
+		var opts []clientv3.OpOption
+		if lease != clientv3.NoLease {
+			opts = append(opts, clientv3.WithLease(lease))
+		}
+
+		if create {
+			_, err = p.client.Put(ctx, p.key(sid), string(data), opts...)
+			return err
+		}
+
+		_, err = p.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.Version(p.key(sid)), ">", 0)).
+			Then(clientv3.OpPut(p.key(sid), string(data), opts...)).
+			Commit()
+		return err
+	})
+}
+
+func (p *EtcdProvider) key(sid string) string {
+	return storageKey(p.prefix, sid)
+}
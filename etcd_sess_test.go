@@ -0,0 +1,392 @@
+package session
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// fakeEtcd is an in-memory stand-in for the KV and Lease requests EtcdProvider makes.
+// The other requests of the embedded nil interfaces panic
+type fakeEtcd struct {
+	clientv3.KV
+	clientv3.Lease
+
+	mu     sync.Mutex
+	rev    int64
+	kvs    map[string]*mvccpb.KeyValue
+	leases map[clientv3.LeaseID]int64
+	nextID clientv3.LeaseID
+	// getErr and txnErr, when set, fail every range request or transaction
+	getErr, txnErr error
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{kvs: make(map[string]*mvccpb.KeyValue), leases: make(map[clientv3.LeaseID]int64)}
+}
+
+// client returns an etcd client sending its requests to f
+func (f *fakeEtcd) client() *clientv3.Client {
+	return &clientv3.Client{KV: f, Lease: f}
+}
+
+func (f *fakeEtcd) Get(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.GetResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.getErr != nil {
+		return nil, f.getErr
+	}
+
+	return f.get(clientv3.OpGet(key, opts...)), nil
+}
+
+func (f *fakeEtcd) Put(ctx context.Context, key, val string, opts ...clientv3.OpOption) (*clientv3.PutResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.put(clientv3.OpPut(key, val, opts...))
+	return &clientv3.PutResponse{}, nil
+}
+
+func (f *fakeEtcd) Delete(ctx context.Context, key string, opts ...clientv3.OpOption) (*clientv3.DeleteResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	n := f.delete(key)
+	return &clientv3.DeleteResponse{Deleted: n}, nil
+}
+
+func (f *fakeEtcd) Txn(ctx context.Context) clientv3.Txn {
+	return &fakeTxn{etcd: f}
+}
+
+func (f *fakeEtcd) Grant(ctx context.Context, ttl int64) (*clientv3.LeaseGrantResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.nextID++
+	f.leases[f.nextID] = ttl
+	return &clientv3.LeaseGrantResponse{ID: f.nextID, TTL: ttl}, nil
+}
+
+func (f *fakeEtcd) Revoke(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseRevokeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.revoke(id)
+	return &clientv3.LeaseRevokeResponse{}, nil
+}
+
+func (f *fakeEtcd) KeepAliveOnce(ctx context.Context, id clientv3.LeaseID) (*clientv3.LeaseKeepAliveResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ttl, ok := f.leases[id]
+	if !ok {
+		return nil, context.DeadlineExceeded
+	}
+
+	return &clientv3.LeaseKeepAliveResponse{ID: id, TTL: ttl}, nil
+}
+
+// setGetErr makes every range request fail with err, or succeed again if nil
+func (f *fakeEtcd) setGetErr(err error) {
+	f.mu.Lock()
+	f.getErr = err
+	f.mu.Unlock()
+}
+
+// setTxnErr makes every transaction fail with err, or succeed again if nil
+func (f *fakeEtcd) setTxnErr(err error) {
+	f.mu.Lock()
+	f.txnErr = err
+	f.mu.Unlock()
+}
+
+// value returns the value stored under key
+func (f *fakeEtcd) value(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if kv, ok := f.kvs[key]; ok {
+		return string(kv.Value)
+	}
+
+	return ""
+}
+
+// expire ends lease as its TTL running out would
+func (f *fakeEtcd) expire(lease clientv3.LeaseID) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.revoke(lease)
+}
+
+// leaseOf returns the lease attached to key and its TTL
+func (f *fakeEtcd) leaseOf(key string) (clientv3.LeaseID, int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	kv, ok := f.kvs[key]
+	if !ok {
+		return clientv3.NoLease, 0
+	}
+
+	lease := clientv3.LeaseID(kv.Lease)
+	return lease, f.leases[lease]
+}
+
+// get runs a range request on a single key, the caller must hold the lock
+func (f *fakeEtcd) get(op clientv3.Op) *clientv3.GetResponse {
+	kv, ok := f.kvs[string(op.KeyBytes())]
+	if !ok {
+		return &clientv3.GetResponse{}
+	}
+	if op.IsCountOnly() {
+		return &clientv3.GetResponse{Count: 1}
+	}
+
+	copied := &mvccpb.KeyValue{
+		Key:            kv.Key,
+		CreateRevision: kv.CreateRevision,
+		ModRevision:    kv.ModRevision,
+		Version:        kv.Version,
+		Value:          kv.Value,
+		Lease:          kv.Lease,
+	}
+	return &clientv3.GetResponse{Kvs: []*mvccpb.KeyValue{copied}, Count: 1}
+}
+
+// put applies a put request, the caller must hold the lock
+func (f *fakeEtcd) put(op clientv3.Op) {
+	// the lease of a put is not exported by Op
+	lease := reflect.ValueOf(op).FieldByName("leaseID").Int()
+
+	f.rev++
+	key := string(op.KeyBytes())
+	kv, ok := f.kvs[key]
+	if !ok {
+		kv = &mvccpb.KeyValue{Key: op.KeyBytes(), CreateRevision: f.rev}
+		f.kvs[key] = kv
+	}
+
+	kv.Value = op.ValueBytes()
+	kv.ModRevision = f.rev
+	kv.Version++
+	kv.Lease = lease
+}
+
+// delete deletes key, the caller must hold the lock
+func (f *fakeEtcd) delete(key string) int64 {
+	if _, ok := f.kvs[key]; !ok {
+		return 0
+	}
+
+	f.rev++
+	delete(f.kvs, key)
+	return 1
+}
+
+// revoke drops lease and its keys, the caller must hold the lock
+func (f *fakeEtcd) revoke(lease clientv3.LeaseID) {
+	delete(f.leases, lease)
+	for key, kv := range f.kvs {
+		if clientv3.LeaseID(kv.Lease) == lease {
+			f.delete(key)
+		}
+	}
+}
+
+// fakeTxn is a transaction of fakeEtcd supporting version and revision compares
+type fakeTxn struct {
+	etcd        *fakeEtcd
+	cmps        []clientv3.Cmp
+	thens, elss []clientv3.Op
+}
+
+func (t *fakeTxn) If(cs ...clientv3.Cmp) clientv3.Txn {
+	t.cmps = append(t.cmps, cs...)
+	return t
+}
+
+func (t *fakeTxn) Then(ops ...clientv3.Op) clientv3.Txn {
+	t.thens = append(t.thens, ops...)
+	return t
+}
+
+func (t *fakeTxn) Else(ops ...clientv3.Op) clientv3.Txn {
+	t.elss = append(t.elss, ops...)
+	return t
+}
+
+func (t *fakeTxn) Commit() (*clientv3.TxnResponse, error) {
+	f := t.etcd
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.txnErr != nil {
+		return nil, f.txnErr
+	}
+
+	succeeded := true
+	for _, cmp := range t.cmps {
+		c := cmp.GetCompare()
+
+		var actual, expected int64
+		kv, ok := f.kvs[string(c.GetKey())]
+		switch c.GetTarget() {
+		case pb.Compare_VERSION:
+			expected = c.GetVersion()
+			if ok {
+				actual = kv.Version
+			}
+		case pb.Compare_MOD:
+			expected = c.GetModRevision()
+			if ok {
+				actual = kv.ModRevision
+			}
+		default:
+			panic("fakeEtcd: unsupported compare target " + c.GetTarget().String())
+		}
+
+		switch c.GetResult() {
+		case pb.Compare_EQUAL:
+			succeeded = succeeded && actual == expected
+		case pb.Compare_NOT_EQUAL:
+			succeeded = succeeded && actual != expected
+		case pb.Compare_GREATER:
+			succeeded = succeeded && actual > expected
+		case pb.Compare_LESS:
+			succeeded = succeeded && actual < expected
+		}
+	}
+
+	ops := t.thens
+	if !succeeded {
+		ops = t.elss
+	}
+
+	for _, op := range ops {
+		switch {
+		case op.IsPut():
+			f.put(op)
+		case op.IsDelete():
+			f.delete(string(op.KeyBytes()))
+		}
+	}
+
+	return &clientv3.TxnResponse{Succeeded: succeeded}, nil
+}
+
+func TestEtcdProviderRegenerateReload(t *testing.T) {
+	etcd := newFakeEtcd()
+	testRegenerateReload(t, func() Provider { return NewEtcdProvider(etcd.client(), nil) })
+}
+
+func TestEtcdProviderSaveAfterDestroy(t *testing.T) {
+	testSaveAfterDestroy(t, NewEtcdProvider(newFakeEtcd().client(), nil))
+}
+
+func TestEtcdProviderLeaseExpiry(t *testing.T) {
+	etcd := newFakeEtcd()
+	p := NewEtcdProvider(etcd.client(), nil)
+
+	store := p.Initialize("sid1", 600)
+	store.Set("user_id", 42)
+	if err := p.Save(store); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	lease, ttl := etcd.leaseOf(p.key("sid1"))
+	if lease == clientv3.NoLease || ttl != 600 {
+		t.Fatalf("session key under lease %d with TTL %d, want a lease of 600 seconds", lease, ttl)
+	}
+	if data, _ := p.Read("sid1", 600).Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v, want 42", data)
+	}
+	if again, _ := etcd.leaseOf(p.key("sid1")); again != lease {
+		t.Errorf("saving moved the session to lease %d, want %d", again, lease)
+	}
+
+	etcd.expire(lease)
+	if p.Exists("sid1") {
+		t.Error("the session outlived its lease")
+	}
+	if p.Read("sid1", 600).Has("user_id") {
+		t.Error("Read after the lease expired returned the old values")
+	}
+}
+
+func TestEtcdProviderNoLeaseWithoutMaxAge(t *testing.T) {
+	etcd := newFakeEtcd()
+	p := NewEtcdProvider(etcd.client(), nil)
+
+	p.Initialize("sid1", 0)
+	if lease, _ := etcd.leaseOf(p.key("sid1")); lease != clientv3.NoLease {
+		t.Errorf("session without max age under lease %d, want none", lease)
+	}
+}
+
+func TestEtcdProviderReadErrorKeepsTheKey(t *testing.T) {
+	etcd := newFakeEtcd()
+	p := NewEtcdProvider(etcd.client(), nil)
+
+	store := p.Initialize("sid1", 3600)
+	store.Set("user_id", 42)
+	if err := p.Save(store); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	saved := etcd.value(p.key("sid1"))
+
+	etcd.setGetErr(context.DeadlineExceeded)
+	failed := p.Read("sid1", 3600)
+	if failed.Has("user_id") {
+		t.Error("the failed read returned the values")
+	}
+
+	failed.Set("user_id", 7)
+	if err := p.Save(failed); err != nil {
+		t.Errorf("Save of the failed read: %v", err)
+	}
+	if etcd.value(p.key("sid1")) != saved {
+		t.Error("the failed read changed the stored session")
+	}
+
+	etcd.setGetErr(nil)
+	if data, _ := p.Read("sid1", 3600).Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v once etcd recovered, want 42", data)
+	}
+}
+
+func TestEtcdProviderRegenerateFailedTxnDeletesTheOldKey(t *testing.T) {
+	etcd := newFakeEtcd()
+	p := NewEtcdProvider(etcd.client(), nil)
+
+	store := p.Initialize("sid1", 600)
+	store.Set("user_id", 42)
+	if err := p.Save(store); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	lease, _ := etcd.leaseOf(p.key("sid1"))
+
+	etcd.setTxnErr(context.DeadlineExceeded)
+	p.Regenerate("sid1", "sid2")
+	etcd.setTxnErr(nil)
+
+	if p.Exists("sid1") {
+		t.Error("the old id survived the failed transaction")
+	}
+	if moved, _ := etcd.leaseOf(p.key("sid2")); moved != lease {
+		t.Errorf("moved session under lease %d, want %d", moved, lease)
+	}
+	if data, _ := p.Read("sid2", 600).Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v under the new id, want 42", data)
+	}
+}
@@ -0,0 +1,387 @@
+package session
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fileExt is the extension of session files
+const fileExt = ".session"
+
+// defaultMaxLive is the number of in-process stores a FileProvider holds when FileOptions.MaxLive is unset
+const defaultMaxLive = 10000
+
+// FileProvider stores each session as a gob encoded file in a directory.
+//
+// Stores are written to their file when saved. So that two
+// requests for the same session can not overwrite each other's changes, the
+// provider hands out a single in-process store per session id, and all file
+// operations are serialized by the provider lock. Files are written to a
+// temporary file first and renamed into place, so readers never see a partial
+// session. The file modification time tracks the last access: sessions idle
+// for longer than their max age are removed when read, or in bulk by GC, which
+// also drops them from the in-process stores. StartGC collects with the max age
+// last passed to Read or Initialize. At most FileOptions.MaxLive stores are held,
+// beyond that the least recently used ones without unsaved changes are dropped and
+// read again from their file when needed.
+//
+// The provider assumes it is the only process using dir.
+//
+//	session.RegisterProvider("file", session.NewFileProvider("/var/lib/app/sessions"))
+type FileProvider struct {
+	dir     string
+	codec   Codec
+	maxLive int
+	live    map[string]*list.Element
+	lru     *list.List
+	// maxAge is the max age last passed to Read or Initialize, used by StartGC
+	maxAge int64
+	sync.Mutex
+
+	gcMu   sync.Mutex
+	gcDone chan struct{}
+}
+
+// FileOptions configures a FileProvider
+type FileOptions struct {
+	// Codec serializes session values, defaults to GobCodec.
+	// Use an EncryptedCodec to encrypt sessions at rest
+	Codec Codec
+	// MaxLive is the number of in-process stores held, defaults to 10000
+	MaxLive int
+}
+
+// fileEntry is a store held in process by a FileProvider
+type fileEntry struct {
+	sid   string
+	store *syncedStore
+	// gone is set once the session is destroyed, regenerated or created anew,
+	// after which store must not write the file anymore
+	gone bool
+}
+
+// NewFileProvider returns a provider storing sessions in dir, which is created if missing
+func NewFileProvider(dir string) *FileProvider {
+	return NewFileProviderWithOptions(dir, nil)
+}
+
+// NewFileProviderWithOptions is like NewFileProvider and configures the provider with opts.
+// opts may be nil to use the defaults
+func NewFileProviderWithOptions(dir string, opts *FileOptions) *FileProvider {
+	p := &FileProvider{
+		dir:     dir,
+		codec:   defaultCodec,
+		maxLive: defaultMaxLive,
+		live:    make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+
+	if opts != nil {
+		if opts.Codec != nil {
+			p.codec = opts.Codec
+		}
+		if opts.MaxLive > 0 {
+			p.maxLive = opts.MaxLive
+		}
+	}
+
+	return p
+}
+
+// Read returns the store for sid, loading it from its file.
+// If the file is missing, expired, corrupt or fails decryption, a new session is created and returned
+func (p *FileProvider) Read(sid string, maxAge int64) Store {
+	p.Lock()
+	if maxAge > 0 {
+		p.maxAge = maxAge
+	}
+
+	path := p.path(sid)
+	info, err := os.Stat(path)
+	if err != nil || expiredFile(info, maxAge) {
+		p.remove(sid)
+		p.Unlock()
+		return p.Initialize(sid, maxAge)
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	if el, ok := p.live[sid]; ok {
+		p.lru.MoveToFront(el)
+		p.Unlock()
+		return el.Value.(*fileEntry).store
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		p.Unlock()
+		return p.Initialize(sid, maxAge)
+	}
+
+	values, err := p.codec.Unmarshal(data)
+	if err != nil {
+		p.Unlock()
+		return p.Initialize(sid, maxAge)
+	}
+
+	store := p.hold(sid, values)
+	p.Unlock()
+
+	return store
+}
+
+// Initialize creates an empty session and its file
+func (p *FileProvider) Initialize(sid string, maxAge int64) Store {
+	p.Lock()
+	if maxAge > 0 {
+		p.maxAge = maxAge
+	}
+	store := p.hold(sid, make(map[string]interface{}))
+	p.Unlock()
+
+	store.create(context.Background())
+	return store
+}
+
+// Exists checks if a session file with passed id exists
+func (p *FileProvider) Exists(sid string) bool {
+	_, err := os.Stat(p.path(sid))
+	return err == nil
+}
+
+// Regenerate renames the session file to the new id, keeping its values
+func (p *FileProvider) Regenerate(oldsid string, sid string) Store {
+	p.Lock()
+
+	values := map[string]interface{}(nil)
+	if el, ok := p.live[oldsid]; ok {
+		values = el.Value.(*fileEntry).store.Snapshot()
+	} else if data, err := os.ReadFile(p.path(oldsid)); err == nil {
+		values, _ = p.codec.Unmarshal(data)
+	}
+
+	if values == nil || os.Rename(p.path(oldsid), p.path(sid)) != nil {
+		p.remove(oldsid)
+		p.Unlock()
+		return p.Initialize(sid, 0)
+	}
+
+	p.drop(oldsid)
+	store := p.hold(sid, values)
+	p.Unlock()
+
+	return store
+}
+
+// Save writes the store to its file if it changed since it was read or last saved
+func (p *FileProvider) Save(store Store) error {
+	return saveSynced(context.Background(), store)
+}
+
+// Flush writes every live session with unsaved changes to its file
+func (p *FileProvider) Flush() error {
+	p.Lock()
+	stores := make([]*syncedStore, 0, len(p.live))
+	for _, el := range p.live {
+		stores = append(stores, el.Value.(*fileEntry).store)
+	}
+	p.Unlock()
+
+	var errs []error
+	for _, store := range stores {
+		if err := store.flush(context.Background()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Touch records an access to the session by updating the modification time of its file
+func (p *FileProvider) Touch(sid string, maxAge int64) {
+	p.Lock()
+	defer p.Unlock()
+
+	now := time.Now()
+	os.Chtimes(p.path(sid), now, now)
+}
+
+// Destroy removes the session file
+func (p *FileProvider) Destroy(sid string) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.remove(sid)
+}
+
+// StartGC starts a goroutine removing expired sessions every interval,
+// replacing the collector started by a previous call
+func (p *FileProvider) StartGC(interval time.Duration) {
+	p.StopGC()
+
+	p.gcMu.Lock()
+	defer p.gcMu.Unlock()
+
+	done := make(chan struct{})
+	p.gcDone = done
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				p.Lock()
+				maxAge := p.maxAge
+				p.Unlock()
+
+				p.GC(maxAge)
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// StopGC stops the collector started by StartGC, if any
+func (p *FileProvider) StopGC() {
+	p.gcMu.Lock()
+	defer p.gcMu.Unlock()
+
+	if p.gcDone != nil {
+		close(p.gcDone)
+		p.gcDone = nil
+	}
+}
+
+// GC removes the files of sessions idle for longer than maxAge seconds,
+// and drops the in-process stores of sessions expired or whose file is gone
+func (p *FileProvider) GC(maxAge int64) {
+	entries, err := os.ReadDir(p.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	for sid := range p.live {
+		if info, err := os.Stat(p.path(sid)); err != nil || expiredFile(info, maxAge) {
+			p.remove(sid)
+		}
+	}
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), fileExt) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || !expiredFile(info, maxAge) {
+			continue
+		}
+
+		os.Remove(filepath.Join(p.dir, entry.Name()))
+	}
+}
+
+// remove deletes the session file and store, the caller must hold the lock
+func (p *FileProvider) remove(sid string) {
+	os.Remove(p.path(sid))
+	p.drop(sid)
+}
+
+// drop forgets the store of sid, which must not write its file anymore.
+// the caller must hold the lock
+func (p *FileProvider) drop(sid string) {
+	if el, ok := p.live[sid]; ok {
+		el.Value.(*fileEntry).gone = true
+		p.lru.Remove(el)
+		delete(p.live, sid)
+	}
+}
+
+// hold returns a new store for sid holding values, replacing the store held for sid if any.
+// The least recently used stores without unsaved changes are evicted beyond maxLive, they
+// still save to their file. the caller must hold the lock
+func (p *FileProvider) hold(sid string, values map[string]interface{}) *syncedStore {
+	p.drop(sid)
+
+	entry := &fileEntry{sid: sid}
+	entry.store = p.store(entry, values)
+	p.live[sid] = p.lru.PushFront(entry)
+
+	for el := p.lru.Back(); el != p.lru.Front() && p.lru.Len() > p.maxLive; {
+		prev := el.Prev()
+		if evicted := el.Value.(*fileEntry); !evicted.store.Dirty() {
+			p.lru.Remove(el)
+			delete(p.live, evicted.sid)
+		}
+		el = prev
+	}
+
+	return entry.store
+}
+
+// store returns a store saving its values to the file of the session of entry
+func (p *FileProvider) store(entry *fileEntry, values map[string]interface{}) *syncedStore {
+	return newSyncedStore(entry.sid, values, func(ctx context.Context, values map[string]interface{}, _ bool) error {
+		data, err := p.codec.Marshal(values)
+		if err != nil {
+			return err
+		}
+
+		p.Lock()
+		defer p.Unlock()
+
+		// do not resurrect a session destroyed or regenerated meanwhile
+		if entry.gone {
+			return nil
+		}
+
+		return p.write(entry.sid, data)
+	})
+}
+
+// write atomically replaces the file of sid with data, the caller must hold the lock
+func (p *FileProvider) write(sid string, data []byte) error {
+	if err := os.MkdirAll(p.dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(p.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), p.path(sid))
+}
+
+// path returns the file of sid, escaped so it can not point outside of dir
+func (p *FileProvider) path(sid string) string {
+	return filepath.Join(p.dir, storageKey("", sid)+fileExt)
+}
+
+// expiredFile reports whether a session file has been idle for longer than maxAge seconds
+func expiredFile(info os.FileInfo, maxAge int64) bool {
+	return maxAge > 0 && time.Since(info.ModTime()) > time.Duration(maxAge)*time.Second
+}
@@ -0,0 +1,96 @@
+package session
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFileProviderRegenerateReload(t *testing.T) {
+	dir := t.TempDir()
+	testRegenerateReload(t, func() Provider { return NewFileProvider(dir) })
+}
+
+func TestFileProviderSaveAfterDestroy(t *testing.T) {
+	testSaveAfterDestroy(t, NewFileProvider(t.TempDir()))
+}
+
+func TestFileProviderGCDropsLiveStores(t *testing.T) {
+	p := NewFileProvider(t.TempDir())
+	p.Initialize("idle", 60)
+	p.Initialize("active", 60)
+	p.Initialize("gone", 60)
+
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(p.path("idle"), old, old)
+	os.Remove(p.path("gone"))
+
+	p.GC(60)
+
+	if _, err := os.Stat(p.path("idle")); !os.IsNotExist(err) {
+		t.Error("the idle session file was not removed")
+	}
+	for sid, want := range map[string]bool{"idle": false, "active": true, "gone": false} {
+		if _, ok := p.live[sid]; ok != want {
+			t.Errorf("%s held in process = %v, want %v", sid, ok, want)
+		}
+	}
+}
+
+func TestFileProviderStartGC(t *testing.T) {
+	var gc GarbageCollector = NewFileProvider(t.TempDir())
+	p := gc.(*FileProvider)
+	p.Initialize("idle", 1)
+
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(p.path("idle"), old, old)
+
+	gc.StartGC(10 * time.Millisecond)
+	defer gc.StopGC()
+
+	deadline := time.Now().Add(time.Second)
+	for p.Exists("idle") {
+		if time.Now().After(deadline) {
+			t.Fatal("the collector did not remove the idle session")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if len(p.live) != 0 {
+		t.Errorf("%d stores held in process after collection, want 0", len(p.live))
+	}
+}
+
+func TestFileProviderBoundsLiveStores(t *testing.T) {
+	dir := t.TempDir()
+	p := NewFileProviderWithOptions(dir, &FileOptions{MaxLive: 2})
+
+	first := p.Initialize("sid1", 3600)
+	for _, sid := range []string{"sid2", "sid3", "sid4"} {
+		store := p.Read(sid, 3600)
+		store.Set("user_id", sid)
+		if err := p.Save(store); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+	}
+
+	p.Lock()
+	held := len(p.live)
+	p.Unlock()
+	if held > 2 {
+		t.Errorf("%d stores held in process, want at most 2", held)
+	}
+
+	first.Set("user_id", "sid1")
+	if err := p.Save(first); err != nil {
+		t.Fatalf("Save of an evicted store: %v", err)
+	}
+	reloaded := NewFileProvider(dir)
+	for _, sid := range []string{"sid1", "sid2", "sid3", "sid4"} {
+		if data, _ := reloaded.Read(sid, 3600).Get("user_id"); data != sid {
+			t.Errorf("user_id = %v in %s, want it saved", data, sid)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package session
+
+// flashPrefix namespaces flash messages in the store.
+// Flash("notice", ...) is stored under "_session.flash.notice", a reserved key, so it
+// never collides with an item set through Set("notice", ...), the two are read
+// independently, and flash messages are left out of Keys and Len
+const flashPrefix = reservedPrefix + "flash."
+
+// legacyFlashPrefix namespaced flash messages before they moved under reservedPrefix
+const legacyFlashPrefix = "_flash."
+
+// Flash stores a message meant to be read once, typically on the request following a redirect
+func (s *Session) Flash(key string, value interface{}) {
+	s.Set(flashPrefix+key, value)
+}
+
+// GetFlash returns a flash message and removes it from the session
+func (s *Session) GetFlash(key string) (interface{}, bool) {
+	return s.Pull(s.flashKey(key))
+}
+
+// GetFlashString returns a string flash message and removes it from the session
+func (s *Session) GetFlashString(key string) (string, bool) {
+	return s.PullString(s.flashKey(key))
+}
+
+// flashKey returns the store key of the flash message key, its legacy key if the
+// message was stored before flash messages moved under reservedPrefix
+func (s *Session) flashKey(key string) string {
+	if s.store != nil && !s.store.Has(flashPrefix+key) && s.store.Has(legacyFlashPrefix+key) {
+		return legacyFlashPrefix + key
+	}
+
+	return flashPrefix + key
+}
@@ -0,0 +1,35 @@
+package session
+
+import "testing"
+
+func TestFlash(t *testing.T) {
+	rs, _ := startRequest(newTestManager(t, nil, nil))
+	rs.Set("notice", "item")
+	rs.Flash("notice", "saved")
+
+	if keys := rs.Keys(); len(keys) != 1 || keys[0] != "notice" || rs.Len() != 1 {
+		t.Errorf("Keys = %v, want only the notice item", keys)
+	}
+
+	if data, ok := rs.GetFlashString("notice"); !ok || data != "saved" {
+		t.Errorf("GetFlashString = %q, %v, want saved", data, ok)
+	}
+	if _, ok := rs.GetFlash("notice"); ok {
+		t.Error("the flash message was read twice")
+	}
+	if data, _ := rs.Get("notice"); data != "item" {
+		t.Errorf("notice = %v, want the item untouched", data)
+	}
+}
+
+func TestFlashLegacyKey(t *testing.T) {
+	rs, _ := startRequest(newTestManager(t, nil, nil))
+	rs.store.Set(legacyFlashPrefix+"notice", "saved")
+
+	if data, ok := rs.GetFlash("notice"); !ok || data != "saved" {
+		t.Errorf("GetFlash = %v, %v, want the message stored under the legacy key", data, ok)
+	}
+	if rs.store.Has(legacyFlashPrefix + "notice") {
+		t.Error("the legacy flash message was not removed")
+	}
+}
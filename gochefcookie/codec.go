@@ -0,0 +1,40 @@
+// Package gochefcookie reads and writes session cookies with github.com/gochef/cookie:
+//
+//	s, err := session.New(&session.Config{
+//		Provider:    "memory",
+//		Key:         "sid",
+//		CookieCodec: gochefcookie.Codec{},
+//	})
+package gochefcookie
+
+import (
+	"net/http"
+
+	"github.com/gochef/cookie"
+	"github.com/gochef/session"
+)
+
+// Codec is a session.CookieCodec backed by github.com/gochef/cookie
+type Codec struct{}
+
+// Read returns the value of the cookie named name with cookie.Get
+func (Codec) Read(name string, r *http.Request) string {
+	return cookie.Get(name, r)
+}
+
+// Write sends the cookie with cookie.Add, using a pooled cookie
+func (Codec) Write(name, value string, opts session.CookieOptions, w http.ResponseWriter) {
+	ck := cookie.AcquireCookie()
+	defer cookie.ReleaseCookie(ck)
+
+	ck.Name = name
+	ck.Value = value
+	ck.Path = opts.Path
+	ck.Domain = opts.Domain
+	ck.MaxAge = opts.MaxAge
+	ck.Secure = opts.Secure
+	ck.HttpOnly = opts.HttpOnly
+	ck.SameSite = opts.SameSite
+
+	cookie.Add(ck, w)
+}
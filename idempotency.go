@@ -0,0 +1,37 @@
+package session
+
+import "time"
+
+// idempotencyKey is the reserved store key holding seen idempotency keys
+const idempotencyKey = "_session.idempotency"
+
+// RememberIdempotencyKey records key as seen for the duration of ttl.
+// returns true the first time a key is seen, and false if it was already seen within its ttl.
+// Expired keys are dropped lazily whenever a key is remembered
+func (s *Session) RememberIdempotencyKey(key string, ttl time.Duration) bool {
+	if !s.writable() {
+		return false
+	}
+
+	first := false
+	now := time.Now().UnixNano()
+
+	s.store.Modify(idempotencyKey, func(data interface{}, ok bool) interface{} {
+		seen, _ := data.(map[string]int64)
+		keys := make(map[string]int64, len(seen)+1)
+		for k, expiresAt := range seen {
+			if expiresAt > now {
+				keys[k] = expiresAt
+			}
+		}
+
+		if _, ok := keys[key]; !ok {
+			first = true
+			keys[key] = now + int64(ttl)
+		}
+
+		return keys
+	})
+
+	return first
+}
@@ -0,0 +1,40 @@
+package session
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRememberIdempotencyKey(t *testing.T) {
+	m := newTestManager(t, nil, nil)
+	rs, w := startRequest(m)
+
+	if !rs.RememberIdempotencyKey("order-1", time.Hour) {
+		t.Fatal("order-1 reported as seen the first time")
+	}
+	if !rs.RememberIdempotencyKey("order-2", time.Hour) {
+		t.Error("order-2 reported as seen the first time")
+	}
+
+	replay, _ := startRequest(m, responseCookie(w, "sid"))
+	if replay.RememberIdempotencyKey("order-1", time.Hour) {
+		t.Error("order-1 replayed within its ttl was not reported as seen")
+	}
+}
+
+func TestRememberIdempotencyKeyExpires(t *testing.T) {
+	rs, _ := startRequest(newTestManager(t, nil, nil))
+
+	rs.RememberIdempotencyKey("order-1", time.Millisecond)
+	rs.RememberIdempotencyKey("order-2", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if !rs.RememberIdempotencyKey("order-1", time.Hour) {
+		t.Error("order-1 reported as seen after its ttl")
+	}
+
+	data, _ := rs.store.Get(idempotencyKey)
+	if keys := data.(map[string]int64); len(keys) != 1 {
+		t.Errorf("%d keys remembered, want the expired order-2 dropped", len(keys))
+	}
+}
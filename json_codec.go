@@ -0,0 +1,209 @@
+package session
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// JSONCodec serializes session values as a JSON object, readable from other languages
+// and when inspecting the backend. Each item is written with the name of its Go type:
+//
+//	{"user_id": {"type": "int", "value": 42}, "roles": {"type": "[]string", "value": ["admin"]}}
+//
+// so that the basic types, their slices, []byte, time.Time, time.Duration and string
+// keyed maps of strings and int64 read back as stored. Items of other types are written
+// without a type and read back as the generic JSON values: float64, string, bool,
+// []interface{} and map[string]interface{}.
+//
+// Types registered with RegisterType that implement both encoding.BinaryMarshaler and
+// encoding.BinaryUnmarshaler are written as the base64 of MarshalBinary and read back
+// with UnmarshalBinary:
+//
+//	{"card": {"type": "billing.Card", "encoding": "binary", "value": "AQID..."}}
+type JSONCodec struct{}
+
+// jsonItem is the JSON form of a session item
+type jsonItem struct {
+	Type     string          `json:"type,omitempty"`
+	Encoding string          `json:"encoding,omitempty"`
+	Value    json.RawMessage `json:"value"`
+}
+
+// binaryEncoding marks the items holding the output of MarshalBinary
+const binaryEncoding = "binary"
+
+var (
+	// jsonTypes are the types JSONCodec reads back as stored, by name
+	jsonTypes = map[string]reflect.Type{}
+
+	// binaryTypes are the registered types marshaling themselves, see registerBinaryType
+	binaryTypes   = map[string]reflect.Type{}
+	binaryTypesMu sync.RWMutex
+
+	binaryMarshalerType   = reflect.TypeOf((*encoding.BinaryMarshaler)(nil)).Elem()
+	binaryUnmarshalerType = reflect.TypeOf((*encoding.BinaryUnmarshaler)(nil)).Elem()
+)
+
+func init() {
+	for _, v := range []interface{}{
+		"", false, []byte(nil),
+		int(0), int8(0), int16(0), int32(0), int64(0),
+		uint(0), uint8(0), uint16(0), uint32(0), uint64(0),
+		float32(0), float64(0),
+		[]string(nil), []int(nil), []int64(nil), []float64(nil), []bool(nil),
+		map[string]string(nil), map[string]int64(nil),
+		time.Time{}, time.Duration(0),
+	} {
+		t := reflect.TypeOf(v)
+		jsonTypes[t.String()] = t
+	}
+}
+
+// registerBinaryType records t for JSONCodec if it implements encoding.BinaryMarshaler
+// and, itself or through a pointer, encoding.BinaryUnmarshaler
+func registerBinaryType(t reflect.Type) {
+	if t == nil || !t.Implements(binaryMarshalerType) {
+		return
+	}
+	if !t.Implements(binaryUnmarshalerType) && !reflect.PointerTo(t).Implements(binaryUnmarshalerType) {
+		return
+	}
+
+	binaryTypesMu.Lock()
+	binaryTypes[t.String()] = t
+	binaryTypesMu.Unlock()
+}
+
+// binaryType returns the registered type marshaling itself named name
+func binaryType(name string) (reflect.Type, bool) {
+	binaryTypesMu.RLock()
+	defer binaryTypesMu.RUnlock()
+
+	t, ok := binaryTypes[name]
+	return t, ok
+}
+
+// marshalBinary encodes data with MarshalBinary if its type is a registered binary type
+func marshalBinary(data interface{}) (jsonItem, bool, error) {
+	t := reflect.TypeOf(data)
+	if t == nil {
+		return jsonItem{}, false, nil
+	}
+	if registered, ok := binaryType(t.String()); !ok || registered != t {
+		return jsonItem{}, false, nil
+	}
+
+	bin, err := data.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return jsonItem{}, true, err
+	}
+
+	raw, err := json.Marshal(bin)
+	return jsonItem{Type: t.String(), Encoding: binaryEncoding, Value: raw}, true, err
+}
+
+// unmarshalBinary decodes an item written by marshalBinary
+func unmarshalBinary(item jsonItem) (interface{}, error) {
+	t, ok := binaryType(item.Type)
+	if !ok {
+		return nil, fmt.Errorf("unknown binary type %q, register it with session.RegisterType", item.Type)
+	}
+
+	var bin []byte
+	if err := json.Unmarshal(item.Value, &bin); err != nil {
+		return nil, err
+	}
+
+	if t.Kind() == reflect.Pointer && t.Implements(binaryUnmarshalerType) {
+		v := reflect.New(t.Elem())
+		if err := v.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(bin); err != nil {
+			return nil, err
+		}
+		return v.Interface(), nil
+	}
+
+	v := reflect.New(t)
+	if err := v.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(bin); err != nil {
+		return nil, err
+	}
+	return v.Elem().Interface(), nil
+}
+
+// Marshal serializes values as a JSON object
+func (JSONCodec) Marshal(values map[string]interface{}) ([]byte, error) {
+	values = persisted(values)
+	items := make(map[string]jsonItem, len(values))
+	for key, data := range values {
+		if item, ok, err := marshalBinary(data); ok {
+			if err != nil {
+				return nil, fmt.Errorf("session: encoding %q: %w", key, err)
+			}
+
+			items[key] = item
+			continue
+		}
+
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("session: encoding %q as JSON: %w", key, err)
+		}
+
+		item := jsonItem{Value: raw}
+		if t := reflect.TypeOf(data); t != nil && jsonTypes[t.String()] == t {
+			item.Type = t.String()
+		}
+
+		items[key] = item
+	}
+
+	return json.Marshal(items)
+}
+
+// Unmarshal deserializes values produced by Marshal
+func (JSONCodec) Unmarshal(data []byte) (map[string]interface{}, error) {
+	var items map[string]jsonItem
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]interface{}, len(items))
+	for key, item := range items {
+		if item.Encoding == binaryEncoding {
+			v, err := unmarshalBinary(item)
+			if err != nil {
+				return nil, fmt.Errorf("session: decoding %q: %w", key, err)
+			}
+
+			values[key] = v
+			continue
+		}
+
+		if item.Type == "" {
+			var v interface{}
+			if err := json.Unmarshal(item.Value, &v); err != nil {
+				return nil, err
+			}
+
+			values[key] = v
+			continue
+		}
+
+		t, ok := jsonTypes[item.Type]
+		if !ok {
+			return nil, fmt.Errorf("session: item %q has unknown JSON type %q", key, item.Type)
+		}
+
+		v := reflect.New(t)
+		if err := json.Unmarshal(item.Value, v.Interface()); err != nil {
+			return nil, err
+		}
+
+		values[key] = v.Elem().Interface()
+	}
+
+	return values, nil
+}
@@ -1,117 +1,481 @@
 package session
 
 import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
 )
 
 type (
-	// MemorySessionStore represents a session store
+	// MemorySessionStore represents a session store.
+	//
+	// The store is dirty once Set, Remove, Clear, Modify or a committed Transaction
+	// changed its values, and clean again once its provider saved it, see Dirty.
+	//
+	// Once its session is destroyed, dropped on expiry or replaced by an import, the store
+	// is empty and ignores changes, so requests still holding it can neither read the
+	// old values nor write new ones
 	MemorySessionStore struct {
 		sid            string
+		createdAt      int64
 		lastAccessedAt int64
+		maxAge         int64
 		expresAt       int64
 		values         map[string]interface{}
+		dirty          bool
+		destroyed      bool
 		sync.RWMutex
+
+		trackAccess bool
+		accessMu    sync.Mutex
+		access      map[string]int
 	}
 )
 
-// MemoryProvider is a variable holding the memory session provider
-var MemoryProvider = &MemorySessionProvider{
-	sessions: make(map[string]*MemorySessionStore),
+// MemoryProvider is a variable holding the memory session provider, registered as "memory".
+// Every Session configured with the "memory" provider shares it, use NewMemoryProvider
+// and Config.ProviderInstance for isolated sessions
+var MemoryProvider = NewMemoryProvider()
+
+// NewMemoryProvider returns a memory provider holding its own sessions
+func NewMemoryProvider() *MemorySessionProvider {
+	return &MemorySessionProvider{
+		sessions: make(map[string]*MemorySessionStore),
+	}
+}
+
+// newMemoryStore returns a store holding values, created and last accessed now
+func newMemoryStore(sid string, values map[string]interface{}) *MemorySessionStore {
+	now := time.Now().Unix()
+	return &MemorySessionStore{
+		sid:            sid,
+		createdAt:      now,
+		lastAccessedAt: now,
+		values:         values,
+	}
 }
 
 // Get fetches an item from the session
 // returns a boolean that indicates whether the item was found or not
 func (s *MemorySessionStore) Get(key string) (interface{}, bool) {
+	if s.trackAccess {
+		s.accessMu.Lock()
+		s.access[key]++
+		s.accessMu.Unlock()
+	}
+
+	s.RLock()
 	data, ok := s.values[key]
+	s.RUnlock()
+
 	return data, ok
 }
 
 // Set puts an item into the session
 func (s *MemorySessionStore) Set(key string, data interface{}) {
 	s.Lock()
-	s.values[key] = data
+	if !s.destroyed {
+		s.values[key] = data
+		s.dirty = true
+	}
+	s.Unlock()
+}
+
+// SetMany puts all values into the session under a single lock
+func (s *MemorySessionStore) SetMany(values map[string]interface{}) {
+	s.Lock()
+	if !s.destroyed {
+		for key, data := range values {
+			s.values[key] = data
+		}
+		s.dirty = true
+	}
 	s.Unlock()
 }
 
 // Remove removes an item from the session
 func (s *MemorySessionStore) Remove(key string) {
+	s.Lock()
+	if !s.destroyed {
+		delete(s.values, key)
+		s.dirty = true
+	}
+	s.Unlock()
+}
+
+// Has reports whether an item is saved under key
+func (s *MemorySessionStore) Has(key string) bool {
 	s.RLock()
-	delete(s.values, key)
+	_, ok := s.values[key]
 	s.RUnlock()
+
+	return ok
+}
+
+// Keys returns the keys of the items in the session, sorted
+func (s *MemorySessionStore) Keys() []string {
+	s.RLock()
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	s.RUnlock()
+
+	sort.Strings(keys)
+	return keys
+}
+
+// Len returns the number of items in the session
+func (s *MemorySessionStore) Len() int {
+	s.RLock()
+	defer s.RUnlock()
+
+	return len(s.values)
+}
+
+// Modify replaces an item in the session with the result of fn, under the write lock
+func (s *MemorySessionStore) Modify(key string, fn func(data interface{}, ok bool) interface{}) interface{} {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.destroyed {
+		return nil
+	}
+
+	data, ok := s.values[key]
+	data = fn(data, ok)
+	s.values[key] = data
+	s.dirty = true
+
+	return data
+}
+
+// GetOrSet returns the item saved under key, or saves and returns the result of fn
+// if there is none, under the write lock
+func (s *MemorySessionStore) GetOrSet(key string, fn func() interface{}) interface{} {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.destroyed {
+		return nil
+	}
+	if data, ok := s.values[key]; ok {
+		return data
+	}
+
+	data := fn()
+	s.values[key] = data
+	s.dirty = true
+
+	return data
+}
+
+// Transaction applies the changes staged by fn atomically, under the write lock
+func (s *MemorySessionStore) Transaction(fn func(tx *Tx) error) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.destroyed {
+		return ErrSessionDestroyed
+	}
+
+	tx := newTx(func(key string) (interface{}, bool) {
+		data, ok := s.values[key]
+		return data, ok
+	})
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	for key, change := range tx.changes {
+		if change.removed {
+			delete(s.values, key)
+		} else {
+			s.values[key] = change.data
+		}
+	}
+
+	if len(tx.changes) > 0 {
+		s.dirty = true
+	}
+
+	return nil
+}
+
+// Snapshot returns a shallow copy of the session values, taken under a single lock
+func (s *MemorySessionStore) Snapshot() map[string]interface{} {
+	s.RLock()
+	defer s.RUnlock()
+
+	values := make(map[string]interface{}, len(s.values))
+	for key, data := range s.values {
+		values[key] = data
+	}
+
+	return values
 }
 
 // ID returns the session ID
 func (s *MemorySessionStore) ID() string {
+	s.RLock()
+	defer s.RUnlock()
+
 	return s.sid
 }
 
+// CreatedAt returns when the session was created, to the second
+func (s *MemorySessionStore) CreatedAt() time.Time {
+	s.RLock()
+	defer s.RUnlock()
+
+	return time.Unix(s.createdAt, 0)
+}
+
+// LastAccessed returns when the session was last read or touched, to the second
+func (s *MemorySessionStore) LastAccessed() time.Time {
+	s.RLock()
+	defer s.RUnlock()
+
+	return time.Unix(s.lastAccessedAt, 0)
+}
+
 // Clear empties the session
 func (s *MemorySessionStore) Clear() {
 	s.Lock()
-	s.values = make(map[string]interface{})
+	if !s.destroyed {
+		s.values = make(map[string]interface{})
+		s.dirty = true
+	}
 	s.Unlock()
 }
 
+// Dirty reports whether the values changed since the store was last saved
+func (s *MemorySessionStore) Dirty() bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.dirty
+}
+
+// markDirty flags the values as changed
+func (s *MemorySessionStore) markDirty() {
+	s.Lock()
+	s.dirty = true
+	s.Unlock()
+}
+
+// takeDirty returns a copy of the values and clears the dirty flag.
+// returns false, and no values, if the store is clean
+func (s *MemorySessionStore) takeDirty() (map[string]interface{}, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	if !s.dirty {
+		return nil, false
+	}
+
+	s.dirty = false
+	values := make(map[string]interface{}, len(s.values))
+	for key, data := range s.values {
+		values[key] = data
+	}
+
+	return values, true
+}
+
+// Size returns the gob encoded size of the session values
+func (s *MemorySessionStore) Size() int {
+	s.RLock()
+	defer s.RUnlock()
+
+	return estimateSize(s.values)
+}
+
+// estimateSize returns the gob encoded size of values,
+// falling back to a rough estimate when they cannot be encoded
+func estimateSize(values map[string]interface{}) int {
+	values = persisted(values)
+	w := &countingWriter{}
+	if err := gob.NewEncoder(w).Encode(values); err == nil {
+		return w.n
+	}
+
+	size := 0
+	for key, data := range values {
+		size += len(key) + len(fmt.Sprint(data))
+	}
+
+	return size
+}
+
+// countingWriter discards writes, counting the bytes written
+type countingWriter struct {
+	n int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += len(p)
+	return len(p), nil
+}
+
+// AccessStats returns the number of Get calls per key.
+// returns nil unless the provider has TrackAccess enabled
+func (s *MemorySessionStore) AccessStats() map[string]int {
+	if !s.trackAccess {
+		return nil
+	}
+
+	s.accessMu.Lock()
+	defer s.accessMu.Unlock()
+
+	stats := make(map[string]int, len(s.access))
+	for key, n := range s.access {
+		stats[key] = n
+	}
+
+	return stats
+}
+
 // MemorySessionProvider represents a MemorySession Provider instance
 type MemorySessionProvider struct {
-	maxAge   int64
+	// TrackAccess enables per-key Get counters on stores created afterwards,
+	// see MemorySessionStore.AccessStats. It adds contention on reads, so it
+	// is meant for tuning and should be set before sessions are created
+	TrackAccess bool
+
+	// DefaultMaxAge is the max age in seconds of sessions created by Regenerate
+	// when the old session is gone, defaults to 86400
+	DefaultMaxAge int64
+
 	sessions map[string]*MemorySessionStore
 	sync.RWMutex
+
+	leaseMu sync.Mutex
+	leases  map[string]*memoryLease
+
+	gcMu   sync.Mutex
+	gcDone chan struct{}
 }
 
-// Read returns a MemorySessionStore
-// If the Session store does not exist, a new one is created and returned
+// memoryLease is an exclusive lease held on a session
+type memoryLease struct {
+	expiresAt time.Time
+}
+
+// Read returns a MemorySessionStore and records the access.
+// If the Session store does not exist or has expired, a new one is created and returned.
+// Hits only take the read lock. Misses take the write lock and look the sid up again
+// before creating the store, so concurrent reads missing the same sid share a single new store
 func (m *MemorySessionProvider) Read(sid string, maxAge int64) Store {
 	m.RLock()
-
-	if session, ok := m.sessions[sid]; ok {
-		go m.Update(sid)
+	if session, ok := m.sessions[sid]; ok && session.touch(time.Now().Unix()) {
 		m.RUnlock()
 		return session
 	}
 	m.RUnlock()
-	return m.Initialize(sid, maxAge)
+
+	m.Lock()
+	defer m.Unlock()
+
+	if session, ok := m.sessions[sid]; ok {
+		if session.touch(time.Now().Unix()) {
+			return session
+		}
+
+		session.destroy()
+		delete(m.sessions, sid)
+	}
+
+	return m.initialize(sid, maxAge)
 }
 
 // Initialize creates and returns a new MemorySessionStore
 func (m *MemorySessionProvider) Initialize(sid string, maxAge int64) Store {
 	m.Lock()
+	defer m.Unlock()
 
-	m.maxAge = maxAge
-	session := &MemorySessionStore{
-		sid:            sid,
-		lastAccessedAt: time.Now().Unix(),
-		values:         make(map[string]interface{}),
-	}
+	return m.initialize(sid, maxAge)
+}
+
+// initialize creates the store of sid. The caller must hold the lock
+func (m *MemorySessionProvider) initialize(sid string, maxAge int64) *MemorySessionStore {
+	session := m.newStore(sid, make(map[string]interface{}))
+	session.maxAge = maxAge
+	session.touch(session.lastAccessedAt)
 
 	m.sessions[sid] = session
-	m.Unlock()
 	return session
 }
 
-// Regenerate regenerates session
+// newStore returns a store for sid set up per the provider options
+func (m *MemorySessionProvider) newStore(sid string, values map[string]interface{}) *MemorySessionStore {
+	session := newMemoryStore(sid, values)
+	if m.TrackAccess {
+		session.trackAccess = true
+		session.access = make(map[string]int)
+	}
+
+	return session
+}
+
+// Regenerate moves the session to sid, keeping its values and expiry.
+// If the old session is gone, a new one is created with DefaultMaxAge
 func (m *MemorySessionProvider) Regenerate(oldsid string, sid string) Store {
+	maxAge := m.DefaultMaxAge
+	if maxAge == 0 {
+		maxAge = 86400
+	}
+
+	return m.RegenerateWithMaxAge(oldsid, sid, maxAge)
+}
+
+// RegenerateWithMaxAge is Regenerate creating the new session with maxAge if the old one is gone
+func (m *MemorySessionProvider) RegenerateWithMaxAge(oldsid string, sid string, maxAge int64) Store {
+	m.Lock()
+
 	if session, ok := m.sessions[oldsid]; ok {
-		go m.Update(oldsid)
+		session.Lock()
 		session.sid = sid
+		session.Unlock()
+
 		m.sessions[sid] = session
 		delete(m.sessions, oldsid)
+		m.Unlock()
 
 		return session
 	}
+	m.Unlock()
 
-	return m.Initialize(sid, m.maxAge)
+	return m.Initialize(sid, maxAge)
+}
+
+// Save marks the store clean, memory stores need no saving
+func (m *MemorySessionProvider) Save(store Store) error {
+	if session, ok := store.(*MemorySessionStore); ok {
+		session.Lock()
+		session.dirty = false
+		session.Unlock()
+	}
+
+	return nil
 }
 
-// Exists checks if a session with passed id exists
+// Flush is a no-op, memory sessions are not persisted
+func (m *MemorySessionProvider) Flush() error {
+	return nil
+}
+
+// Exists checks if a session with passed id exists and has not expired
 func (m *MemorySessionProvider) Exists(sid string) bool {
 	m.RLock()
 	defer m.RUnlock()
 
-	if _, ok := m.sessions[sid]; ok {
-		return true
+	if session, ok := m.sessions[sid]; ok {
+		return !session.expired(time.Now().Unix())
 	}
 
 	return false
@@ -123,16 +487,304 @@ func (m *MemorySessionProvider) Update(sid string) {
 	defer m.Unlock()
 
 	if session, ok := m.sessions[sid]; ok {
-		session.lastAccessedAt = time.Now().Unix()
+		session.touch(time.Now().Unix())
+	}
+}
+
+// Touch records an access to the session, pushing its expiry back by its own max age
+func (m *MemorySessionProvider) Touch(sid string, maxAge int64) {
+	m.Update(sid)
+}
+
+// Expire marks a session as expired, the next Read replaces it with a fresh one
+func (m *MemorySessionProvider) Expire(sid string) {
+	m.Lock()
+	defer m.Unlock()
+
+	if session, ok := m.sessions[sid]; ok {
+		session.Lock()
+		session.expresAt = time.Now().Unix()
+		session.Unlock()
 	}
 }
 
-// Destroy flushes the session
+// Destroy flushes the session, emptying its store for requests still holding it
 func (m *MemorySessionProvider) Destroy(sid string) {
 	m.Lock()
 	defer m.Unlock()
 
-	if _, ok := m.sessions[sid]; ok {
+	if session, ok := m.sessions[sid]; ok {
+		session.destroy()
 		delete(m.sessions, sid)
 	}
 }
+
+// ListSessions returns a page of session metadata ordered by creation time,
+// and the total number of sessions held by the provider
+func (m *MemorySessionProvider) ListSessions(offset, limit int) ([]SessionInfo, int) {
+	m.RLock()
+	infos := make([]SessionInfo, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		infos = append(infos, SessionInfo{
+			ID:             session.sid,
+			CreatedAt:      time.Unix(session.createdAt, 0),
+			LastAccessedAt: session.LastAccessed(),
+		})
+	}
+	m.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool {
+		if !infos[i].CreatedAt.Equal(infos[j].CreatedAt) {
+			return infos[i].CreatedAt.Before(infos[j].CreatedAt)
+		}
+		return infos[i].ID < infos[j].ID
+	})
+
+	total := len(infos)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > total {
+		offset = total
+	}
+
+	end := total
+	if limit >= 0 && offset+limit < total {
+		end = offset + limit
+	}
+
+	return infos[offset:end], total
+}
+
+// Count returns the number of sessions that have not expired
+func (m *MemorySessionProvider) Count() int {
+	m.RLock()
+	defer m.RUnlock()
+
+	now := time.Now().Unix()
+	n := 0
+	for _, session := range m.sessions {
+		if !session.expired(now) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Each calls fn for every session that has not expired, until fn returns false.
+// The sessions are collected under the lock and fn is called without holding it
+func (m *MemorySessionProvider) Each(fn func(sid string, store Store) bool) {
+	m.RLock()
+	now := time.Now().Unix()
+	sessions := make(map[string]*MemorySessionStore, len(m.sessions))
+	for sid, session := range m.sessions {
+		if !session.expired(now) {
+			sessions[sid] = session
+		}
+	}
+	m.RUnlock()
+
+	for sid, session := range sessions {
+		if !fn(sid, session) {
+			return
+		}
+	}
+}
+
+// DestroyWhere destroys the sessions whose store fn returns true for. The matching
+// sessions are collected and deleted under a single lock, so a session can not be
+// read between the match and its deletion. fn must not call into the provider
+func (m *MemorySessionProvider) DestroyWhere(fn func(store Store) bool) {
+	m.Lock()
+	defer m.Unlock()
+
+	var sids []string
+	for sid, session := range m.sessions {
+		if fn(session) {
+			sids = append(sids, sid)
+		}
+	}
+
+	for _, sid := range sids {
+		m.sessions[sid].destroy()
+		delete(m.sessions, sid)
+	}
+}
+
+// LeaseSession grants an exclusive lease on sid for d,
+// refusing it while another unexpired lease is held
+func (m *MemorySessionProvider) LeaseSession(sid string, d time.Duration) (func(), bool) {
+	m.leaseMu.Lock()
+	defer m.leaseMu.Unlock()
+
+	m.pruneLeases(time.Now())
+	if _, ok := m.leases[sid]; ok {
+		return nil, false
+	}
+
+	if m.leases == nil {
+		m.leases = make(map[string]*memoryLease)
+	}
+
+	lease := &memoryLease{expiresAt: time.Now().Add(d)}
+	m.leases[sid] = lease
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			m.leaseMu.Lock()
+			if m.leases[sid] == lease {
+				delete(m.leases, sid)
+			}
+			m.leaseMu.Unlock()
+		})
+	}
+
+	return release, true
+}
+
+// pruneLeases drops the leases expired at now, the caller must hold leaseMu
+func (m *MemorySessionProvider) pruneLeases(now time.Time) {
+	for sid, lease := range m.leases {
+		if !now.Before(lease.expiresAt) {
+			delete(m.leases, sid)
+		}
+	}
+}
+
+// ExportSession serializes the session with passed id and its metadata
+func (m *MemorySessionProvider) ExportSession(sid string) ([]byte, error) {
+	m.RLock()
+	session, ok := m.sessions[sid]
+	if !ok {
+		m.RUnlock()
+		return nil, errors.New("session: no session to export")
+	}
+
+	e := &exportedSession{
+		CreatedAt:      session.createdAt,
+		LastAccessedAt: session.LastAccessed().Unix(),
+		MaxAge:         session.maxAge,
+	}
+	m.RUnlock()
+
+	e.Values = session.Snapshot()
+	return encodeExport(e)
+}
+
+// ImportSession stores an exported session under sid, replacing any existing one
+func (m *MemorySessionProvider) ImportSession(sid string, data []byte) error {
+	e, err := decodeExport(data)
+	if err != nil {
+		return err
+	}
+
+	session := m.newStore(sid, e.Values)
+	session.createdAt = e.CreatedAt
+	session.maxAge = e.MaxAge
+	session.touch(e.LastAccessedAt)
+
+	m.Lock()
+	if old, ok := m.sessions[sid]; ok {
+		old.destroy()
+	}
+	m.sessions[sid] = session
+	m.Unlock()
+
+	return nil
+}
+
+// StartGC starts a goroutine removing expired sessions every interval,
+// replacing the collector started by a previous call
+func (m *MemorySessionProvider) StartGC(interval time.Duration) {
+	m.StopGC()
+
+	m.gcMu.Lock()
+	defer m.gcMu.Unlock()
+
+	done := make(chan struct{})
+	m.gcDone = done
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				m.GC()
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// StopGC stops the collector started by StartGC, if any
+func (m *MemorySessionProvider) StopGC() {
+	m.gcMu.Lock()
+	defer m.gcMu.Unlock()
+
+	if m.gcDone != nil {
+		close(m.gcDone)
+		m.gcDone = nil
+	}
+}
+
+// GC removes every session and lease that has expired
+func (m *MemorySessionProvider) GC() {
+	m.leaseMu.Lock()
+	m.pruneLeases(time.Now())
+	m.leaseMu.Unlock()
+
+	m.Lock()
+	defer m.Unlock()
+
+	now := time.Now().Unix()
+	for sid, session := range m.sessions {
+		if session.expired(now) {
+			session.destroy()
+			delete(m.sessions, sid)
+		}
+	}
+}
+
+// destroy empties the store and makes it ignore further changes
+func (s *MemorySessionStore) destroy() {
+	s.Lock()
+	s.values = make(map[string]interface{})
+	s.destroyed = true
+	s.Unlock()
+}
+
+// expired reports whether the session is expired at now
+func (s *MemorySessionStore) expired(now int64) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.expiredLocked(now)
+}
+
+// expiredLocked is expired for callers holding the store lock
+func (s *MemorySessionStore) expiredLocked(now int64) bool {
+	return s.expresAt != 0 && s.expresAt <= now
+}
+
+// touch records an access at now, pushing the expiry back by the session max age.
+// An expired session stays expired, touch reports whether the session is still alive
+func (s *MemorySessionStore) touch(now int64) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.expiredLocked(now) {
+		return false
+	}
+
+	s.lastAccessedAt = now
+	if s.maxAge > 0 {
+		s.expresAt = now + s.maxAge
+	}
+
+	return true
+}
@@ -0,0 +1,370 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryProviderSealsDroppedStores(t *testing.T) {
+	for name, drop := range map[string]func(p *MemorySessionProvider){
+		"destroy": func(p *MemorySessionProvider) { p.Destroy("sid1") },
+		"gc": func(p *MemorySessionProvider) {
+			p.Expire("sid1")
+			p.GC()
+		},
+		"expired read": func(p *MemorySessionProvider) {
+			p.Expire("sid1")
+			p.Read("sid1", 3600)
+		},
+		"import": func(p *MemorySessionProvider) {
+			other := NewMemoryProvider()
+			other.Initialize("sid1", 3600)
+			data, _ := other.ExportSession("sid1")
+			if err := p.ImportSession("sid1", data); err != nil {
+				t.Fatalf("ImportSession: %v", err)
+			}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			p := NewMemoryProvider()
+			held := p.Initialize("sid1", 3600)
+			held.Set("user_id", 42)
+			held.Set("cart", "book")
+
+			drop(p)
+			if held.Has("user_id") {
+				t.Error("the dropped store still holds its values")
+			}
+
+			held.Set("user_id", 7)
+			held.Remove("cart")
+			held.Clear()
+			if held.Len() != 0 {
+				t.Errorf("the dropped store accepted changes, holds %d items", held.Len())
+			}
+			if current := p.Read("sid1", 3600); current.Has("user_id") {
+				t.Error("a change to the dropped store reached the current session")
+			}
+		})
+	}
+}
+
+func TestMemoryStoreDestroyedIgnoresRemoveAndClear(t *testing.T) {
+	store := newMemoryStore("sid1", map[string]interface{}{"user_id": 42})
+	store.destroy()
+	store.Remove("user_id")
+	store.Clear()
+
+	if store.Dirty() {
+		t.Error("Remove or Clear marked the destroyed store dirty")
+	}
+}
+
+func TestMemoryProviderPrunesExpiredLeases(t *testing.T) {
+	p := NewMemoryProvider()
+
+	for _, sid := range []string{"sid1", "sid2", "sid3"} {
+		if _, ok := p.LeaseSession(sid, time.Millisecond); !ok {
+			t.Fatalf("lease on %s refused", sid)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	p.GC()
+	if n := len(p.leases); n != 0 {
+		t.Errorf("%d expired leases kept after GC, want 0", n)
+	}
+
+	for _, sid := range []string{"sid1", "sid2"} {
+		p.LeaseSession(sid, time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	release, ok := p.LeaseSession("sid3", time.Hour)
+	if !ok {
+		t.Fatal("lease on sid3 refused")
+	}
+	defer release()
+	if n := len(p.leases); n != 1 {
+		t.Errorf("%d leases held after acquiring one, want 1", n)
+	}
+	if _, ok := p.LeaseSession("sid3", time.Hour); ok {
+		t.Error("a second lease on sid3 was granted")
+	}
+}
+
+func TestMemoryProviderConcurrentReads(t *testing.T) {
+	p := NewMemoryProvider()
+	p.Initialize("sid1", 3600).Set("user_id", 42)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 100; j++ {
+				if data, _ := p.Read("sid1", 3600).Get("user_id"); data != 42 {
+					t.Errorf("user_id = %v, want 42", data)
+					return
+				}
+				p.Read("missing", 3600)
+				p.ListSessions(0, 10)
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for j := 0; j < 100; j++ {
+			p.Touch("sid1", 3600)
+			p.Exists("sid1")
+			p.ExportSession("sid1")
+			p.Expire("missing")
+		}
+	}()
+	wg.Wait()
+
+	if store := p.Read("missing", 3600); store != p.Read("missing", 3600) {
+		t.Error("concurrent misses created distinct stores")
+	}
+}
+
+func TestMemoryProviderReadExpired(t *testing.T) {
+	p := NewMemoryProvider()
+	old := p.Initialize("sid1", 3600)
+	old.Set("user_id", 42)
+
+	p.Expire("sid1")
+	store := p.Read("sid1", 3600)
+	if store == old || store.Has("user_id") {
+		t.Error("Read returned the expired session")
+	}
+	if !p.Exists("sid1") {
+		t.Error("no fresh session replaced the expired one")
+	}
+}
+
+func TestMemoryProviderRegenerateKeepsTheExpiry(t *testing.T) {
+	p := NewMemoryProvider()
+	store := p.Initialize("sid1", 3600).(*MemorySessionStore)
+
+	store.Lock()
+	store.expresAt -= 1000
+	expiresAt := store.expresAt
+	store.Unlock()
+
+	p.Regenerate("sid1", "sid2")
+
+	store.RLock()
+	defer store.RUnlock()
+	if store.expresAt != expiresAt {
+		t.Errorf("Regenerate moved the expiry by %d seconds", store.expresAt-expiresAt)
+	}
+}
+
+func TestMemoryProviderListSessions(t *testing.T) {
+	p := NewMemoryProvider()
+	for _, sid := range []string{"sid3", "sid1", "sid4", "sid0", "sid2"} {
+		// created in the same second, the page is ordered by id
+		p.Initialize(sid, 3600).(*MemorySessionStore).createdAt = 1000
+	}
+
+	for _, tc := range []struct {
+		offset, limit int
+		want          []string
+	}{
+		{0, 2, []string{"sid0", "sid1"}},
+		{2, 2, []string{"sid2", "sid3"}},
+		{4, 2, []string{"sid4"}},
+		{5, 2, nil},
+		{9, 2, nil},
+		{-1, 1, []string{"sid0"}},
+		{3, -1, []string{"sid3", "sid4"}},
+	} {
+		infos, total := p.ListSessions(tc.offset, tc.limit)
+		if total != 5 {
+			t.Errorf("ListSessions(%d, %d) total = %d, want 5", tc.offset, tc.limit, total)
+		}
+
+		var ids []string
+		for _, info := range infos {
+			ids = append(ids, info.ID)
+		}
+		if strings.Join(ids, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("ListSessions(%d, %d) = %v, want %v", tc.offset, tc.limit, ids, tc.want)
+		}
+	}
+}
+
+func TestMemoryStoreSize(t *testing.T) {
+	store := newMemoryStore("sid1", make(map[string]interface{}))
+	empty := store.Size()
+
+	store.Set("user_id", 42)
+	small := store.Size()
+	store.Set("bio", strings.Repeat("x", 1000))
+	large := store.Size()
+
+	if !(empty < small && small+1000 <= large) {
+		t.Errorf("sizes %d, %d, %d, want them growing with the values", empty, small, large)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(store.Snapshot()); err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if large != buf.Len() {
+		t.Errorf("Size = %d, want the gob encoded length %d", large, buf.Len())
+	}
+
+	store.Remove("bio")
+	if store.Size() != small {
+		t.Errorf("Size = %d after Remove, want %d", store.Size(), small)
+	}
+}
+
+func TestMemoryStoreAccessStats(t *testing.T) {
+	p := NewMemoryProvider()
+	p.TrackAccess = true
+	store := p.Initialize("sid1", 3600).(*MemorySessionStore)
+	store.Set("user_id", 42)
+
+	store.Get("user_id")
+	store.Get("user_id")
+	store.Get("missing")
+
+	stats := store.AccessStats()
+	if stats["user_id"] != 2 || stats["missing"] != 1 || len(stats) != 2 {
+		t.Errorf("AccessStats = %v, want user_id 2 and missing 1", stats)
+	}
+
+	stats["user_id"] = 100
+	if store.AccessStats()["user_id"] != 2 {
+		t.Error("AccessStats returned the live counters")
+	}
+}
+
+func TestMemoryStoreAccessStatsDisabled(t *testing.T) {
+	store := NewMemoryProvider().Initialize("sid1", 3600).(*MemorySessionStore)
+	store.Get("user_id")
+
+	if stats := store.AccessStats(); stats != nil {
+		t.Errorf("AccessStats = %v without TrackAccess, want nil", stats)
+	}
+}
+
+func TestMemoryStoreConcurrentSetRemove(t *testing.T) {
+	store := newMemoryStore("sid1", make(map[string]interface{}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			key := "key" + strconv.Itoa(i%4)
+			for j := 0; j < 200; j++ {
+				store.Set(key, j)
+				store.Remove(key)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := store.Len(); n != 0 {
+		t.Errorf("%d items left, want every key removed", n)
+	}
+}
+
+func TestMemoryStoreConcurrentGetSet(t *testing.T) {
+	store := newMemoryStore("sid1", map[string]interface{}{"counter": 0})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				store.Set("counter", j)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 200; j++ {
+				data, ok := store.Get("counter")
+				if _, isInt := data.(int); !ok || !isInt {
+					t.Errorf("counter = %v, %v while being set, want an int", data, ok)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMemoryProviderConcurrentRegenerate(t *testing.T) {
+	p := NewMemoryProvider()
+	p.Initialize("sid0", 3600).Set("user_id", 42)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 200; i++ {
+			p.Regenerate("sid"+strconv.Itoa(i), "sid"+strconv.Itoa(i+1))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 200; i++ {
+			store := p.Read("sid"+strconv.Itoa(i), 3600)
+			store.ID()
+			p.Exists("sid" + strconv.Itoa(i+1))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 200; i += 7 {
+			p.Destroy("sid" + strconv.Itoa(i))
+			p.ListSessions(0, 10)
+		}
+	}()
+	wg.Wait()
+
+	store := p.Read("sid200", 3600)
+	if store.ID() != "sid200" {
+		t.Errorf("store id = %q, want sid200", store.ID())
+	}
+}
+
+func TestMemoryProviderRegenerateGoneUsesTheConfiguredMaxAge(t *testing.T) {
+	p := NewMemoryProvider()
+	m := newTestManager(t, p, func(cfg *Config) { cfg.MaxAge = 60 })
+
+	rs, _ := startRequest(m)
+	p.Destroy(rs.ID())
+	rs.Regenerate(httptest.NewRecorder())
+
+	p.RLock()
+	store, ok := p.sessions[rs.ID()]
+	p.RUnlock()
+	if !ok {
+		t.Fatal("no session under the regenerated id")
+	}
+	if store.maxAge != 60 {
+		t.Errorf("regenerated session max age = %d, want the 60 configured", store.maxAge)
+	}
+}
@@ -0,0 +1,248 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// memcachedRelativeLimit is the longest expiration memcached takes as relative seconds,
+// longer ones are read as a unix time
+const memcachedRelativeLimit = 30 * 24 * 60 * 60
+
+// memcachedMaxAgeFlag is set in the flags of items whose lower bits hold the max age
+// of the session, which Regenerate moves the session with
+const memcachedMaxAgeFlag = 1 << 31
+
+// ErrItemTooLarge is returned when saving a session that exceeds the memcached item size limit
+var ErrItemTooLarge = errors.New("session: encoded session exceeds the memcached item size limit")
+
+type (
+	// MemcachedProvider stores sessions in Memcached, each gob encoded under its own key
+	// with an expiration equal to the session max age. Reads refresh the expiration,
+	// changes are written in a single SET when the store is saved.
+	//
+	// Memcached refuses items larger than its item size limit, 1MB by default. Saving a
+	// session encoding to more than MaxItemSize fails with ErrItemTooLarge: the store
+	// stays dirty and Memcached keeps the last session saved successfully.
+	//
+	// Register it to select it by name in Config.Provider:
+	//
+	//	session.RegisterProvider("memcached", session.NewMemcachedProvider(memcache.New("127.0.0.1:11211"), nil))
+	MemcachedProvider struct {
+		client        *memcache.Client
+		prefix        string
+		defaultMaxAge int64
+		maxItemSize   int
+		codec         Codec
+	}
+
+	// MemcachedOptions configures a MemcachedProvider
+	MemcachedOptions struct {
+		// Prefix is prepended to the session id to build keys, defaults to "session:"
+		Prefix string
+		// DefaultMaxAge is the expiration in seconds of sessions created by Regenerate,
+		// or moved by it from an item saved without its max age, defaults to 86400
+		DefaultMaxAge int64
+		// MaxItemSize is the largest encoded session in bytes, defaults to 1MB to
+		// match the memcached default. Raise it along with the server's -I option
+		MaxItemSize int
+		// Codec serializes session values, defaults to GobCodec.
+		// Use an EncryptedCodec to encrypt sessions at rest
+		Codec Codec
+	}
+)
+
+// NewMemcachedProvider returns a provider storing sessions through client.
+// Set client.Timeout to bound every request. opts may be nil to use the defaults
+func NewMemcachedProvider(client *memcache.Client, opts *MemcachedOptions) *MemcachedProvider {
+	p := &MemcachedProvider{
+		client:        client,
+		prefix:        "session:",
+		defaultMaxAge: 86400,
+		maxItemSize:   1 << 20,
+		codec:         defaultCodec,
+	}
+
+	if opts != nil {
+		if opts.Prefix != "" {
+			p.prefix = opts.Prefix
+		}
+		if opts.DefaultMaxAge > 0 {
+			p.defaultMaxAge = opts.DefaultMaxAge
+		}
+		if opts.MaxItemSize > 0 {
+			p.maxItemSize = opts.MaxItemSize
+		}
+		if opts.Codec != nil {
+			p.codec = opts.Codec
+		}
+	}
+
+	return p
+}
+
+// Read fetches the session from Memcached and refreshes its expiration.
+// If the session does not exist or can not be decoded or decrypted, a new one is created and returned.
+// If the GET fails the error is logged and an empty store is returned that is never saved,
+// leaving the item as is
+func (p *MemcachedProvider) Read(sid string, maxAge int64) Store {
+	item, err := p.client.Get(p.key(sid))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return p.Initialize(sid, maxAge)
+	}
+	if err != nil {
+		// a failing Memcached must not wipe the session, only this request goes without it
+		log.Printf("session: reading session: %v", err)
+		return newMemoryStore(sid, make(map[string]interface{}))
+	}
+
+	values, err := p.codec.Unmarshal(item.Value)
+	if err != nil {
+		return p.Initialize(sid, maxAge)
+	}
+
+	expiration := memcachedExpiration(maxAge)
+	if expiration > 0 {
+		p.client.Touch(p.key(sid), expiration)
+	}
+
+	return p.store(sid, values, maxAge)
+}
+
+// Initialize creates an empty session in Memcached expiring after maxAge seconds
+func (p *MemcachedProvider) Initialize(sid string, maxAge int64) Store {
+	store := p.store(sid, make(map[string]interface{}), maxAge)
+	store.create(context.Background())
+	return store
+}
+
+// Exists checks if a session with passed id exists
+func (p *MemcachedProvider) Exists(sid string) bool {
+	_, err := p.client.Get(p.key(sid))
+	return err == nil
+}
+
+// Regenerate copies the session to the new id and deletes the old key.
+// Memcached has no rename nor TTL lookup, items carry the max age of their session
+// in their flags so that the moved session keeps the max age it was read with.
+// The old key is deleted even if the copy fails, the values read are then set anew
+func (p *MemcachedProvider) Regenerate(oldsid string, sid string) Store {
+	// the old id must not stay usable, whatever happens to the copy
+	defer p.client.Delete(p.key(oldsid))
+
+	item, err := p.client.Get(p.key(oldsid))
+	if err != nil {
+		if !errors.Is(err, memcache.ErrCacheMiss) {
+			log.Printf("session: reading session: %v", err)
+		}
+		return p.Initialize(sid, p.defaultMaxAge)
+	}
+
+	values, err := p.codec.Unmarshal(item.Value)
+	if err != nil {
+		return p.Initialize(sid, p.defaultMaxAge)
+	}
+
+	maxAge := p.defaultMaxAge
+	if item.Flags&memcachedMaxAgeFlag != 0 {
+		maxAge = int64(item.Flags &^ memcachedMaxAgeFlag)
+	}
+
+	err = p.client.Add(&memcache.Item{
+		Key:        p.key(sid),
+		Value:      item.Value,
+		Flags:      memcachedFlags(maxAge),
+		Expiration: memcachedExpiration(maxAge),
+	})
+	if err != nil {
+		log.Printf("session: moving session: %v", err)
+		store := p.store(sid, values, maxAge)
+		store.create(context.Background())
+		return store
+	}
+
+	return p.store(sid, values, maxAge)
+}
+
+// Save writes the store to Memcached if it changed since it was read or last saved
+func (p *MemcachedProvider) Save(store Store) error {
+	return saveSynced(context.Background(), store)
+}
+
+// Touch refreshes the expiration of the session key to maxAge seconds
+func (p *MemcachedProvider) Touch(sid string, maxAge int64) {
+	if expiration := memcachedExpiration(maxAge); expiration > 0 {
+		p.client.Touch(p.key(sid), expiration)
+	}
+}
+
+// Destroy deletes the session key
+func (p *MemcachedProvider) Destroy(sid string) {
+	p.client.Delete(p.key(sid))
+}
+
+// store returns a store saving its values to the key of sid, expiring after maxAge seconds.
+// Only creating the session sets a missing key, saving never recreates a key destroyed meanwhile
+func (p *MemcachedProvider) store(sid string, values map[string]interface{}, maxAge int64) *syncedStore {
+	return newSyncedStore(sid, values, func(ctx context.Context, values map[string]interface{}, create bool) error {
+		data, err := p.codec.Marshal(values)
+		if err != nil {
+			return err
+		}
+
+		if len(data) > p.maxItemSize {
+			return fmt.Errorf("%w: %d bytes, limit is %d", ErrItemTooLarge, len(data), p.maxItemSize)
+		}
+
+		item := &memcache.Item{
+			Key:        p.key(sid),
+			Value:      data,
+			Flags:      memcachedFlags(maxAge),
+			Expiration: memcachedExpiration(maxAge),
+		}
+		if create {
+			return p.client.Set(item)
+		}
+
+		if err := p.client.Replace(item); err != nil && !errors.Is(err, memcache.ErrNotStored) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (p *MemcachedProvider) key(sid string) string {
+	return storageKey(p.prefix, sid)
+}
+
+// memcachedFlags returns the flags of an item holding a session of maxAge seconds
+func memcachedFlags(maxAge int64) uint32 {
+	if maxAge < 0 {
+		maxAge = 0
+	}
+	if maxAge >= memcachedMaxAgeFlag {
+		maxAge = memcachedMaxAgeFlag - 1
+	}
+
+	return memcachedMaxAgeFlag | uint32(maxAge)
+}
+
+// memcachedExpiration converts a max age in seconds to an item expiration, zero meaning none.
+// Max ages beyond the relative limit are sent as the unix time they end at
+func memcachedExpiration(maxAge int64) int32 {
+	if maxAge <= 0 {
+		return 0
+	}
+
+	if maxAge > memcachedRelativeLimit {
+		return int32(time.Now().Unix() + maxAge)
+	}
+
+	return int32(maxAge)
+}
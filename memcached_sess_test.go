@@ -0,0 +1,293 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+// fakeMemcached is an in-process server speaking the subset of the memcached
+// text protocol MemcachedProvider uses
+type fakeMemcached struct {
+	addr string
+
+	mu    sync.Mutex
+	items map[string]fakeMemcachedItem
+	cas   uint64
+	// failGets and failAdds, when set, answer every get or add with a server error
+	failGets, failAdds bool
+}
+
+// fakeMemcachedItem is an item held by fakeMemcached
+type fakeMemcachedItem struct {
+	value      []byte
+	flags      uint32
+	expiration int32
+	cas        uint64
+}
+
+// newFakeMemcached starts a server, stopped when the test ends
+func newFakeMemcached(t *testing.T) *fakeMemcached {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+
+	m := &fakeMemcached{addr: ln.Addr().String(), items: make(map[string]fakeMemcachedItem)}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+
+	return m
+}
+
+// client returns a client of the server
+func (m *fakeMemcached) client() *memcache.Client {
+	return memcache.New(m.addr)
+}
+
+// expiration returns the expiration the item under key was last stored or touched with
+func (m *fakeMemcached) expiration(key string) int32 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.items[key].expiration
+}
+
+// value returns the value of the item under key
+func (m *fakeMemcached) value(key string) []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.items[key].value
+}
+
+// setFailGets makes every get fail, or succeed again if fail is false
+func (m *fakeMemcached) setFailGets(fail bool) {
+	m.mu.Lock()
+	m.failGets = fail
+	m.mu.Unlock()
+}
+
+// setFailAdds makes every add fail, or succeed again if fail is false
+func (m *fakeMemcached) setFailAdds(fail bool) {
+	m.mu.Lock()
+	m.failAdds = fail
+	m.mu.Unlock()
+}
+
+func (m *fakeMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if err := m.handle(fields, r, w); err != nil {
+			return
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers a single command
+func (m *fakeMemcached) handle(fields []string, r *bufio.Reader, w *bufio.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	switch cmd := fields[0]; cmd {
+	case "get", "gets":
+		if m.failGets {
+			w.WriteString("SERVER_ERROR out of memory\r\n")
+			return nil
+		}
+		for _, key := range fields[1:] {
+			if item, ok := m.items[key]; ok {
+				fmt.Fprintf(w, "VALUE %s %d %d %d\r\n%s\r\n", key, item.flags, len(item.value), item.cas, item.value)
+			}
+		}
+		w.WriteString("END\r\n")
+
+	case "set", "add", "replace", "cas":
+		flags, _ := strconv.ParseUint(fields[2], 10, 32)
+		expiration, _ := strconv.ParseInt(fields[3], 10, 32)
+		size, _ := strconv.Atoi(fields[4])
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+
+		key := fields[1]
+		current, exists := m.items[key]
+		switch {
+		case cmd == "add" && m.failAdds:
+			w.WriteString("SERVER_ERROR out of memory\r\n")
+			return nil
+		case cmd == "add" && exists, cmd == "replace" && !exists:
+			w.WriteString("NOT_STORED\r\n")
+			return nil
+		case cmd == "cas" && !exists:
+			w.WriteString("NOT_FOUND\r\n")
+			return nil
+		case cmd == "cas" && fields[5] != strconv.FormatUint(current.cas, 10):
+			w.WriteString("EXISTS\r\n")
+			return nil
+		}
+
+		m.cas++
+		m.items[key] = fakeMemcachedItem{value: data[:size], flags: uint32(flags), expiration: int32(expiration), cas: m.cas}
+		w.WriteString("STORED\r\n")
+
+	case "delete":
+		if _, ok := m.items[fields[1]]; !ok {
+			w.WriteString("NOT_FOUND\r\n")
+			return nil
+		}
+
+		delete(m.items, fields[1])
+		w.WriteString("DELETED\r\n")
+
+	case "touch":
+		item, ok := m.items[fields[1]]
+		if !ok {
+			w.WriteString("NOT_FOUND\r\n")
+			return nil
+		}
+
+		expiration, _ := strconv.ParseInt(fields[2], 10, 32)
+		item.expiration = int32(expiration)
+		m.items[fields[1]] = item
+		w.WriteString("TOUCHED\r\n")
+
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+
+	return nil
+}
+
+func TestMemcachedProviderRegenerateReload(t *testing.T) {
+	server := newFakeMemcached(t)
+	testRegenerateReload(t, func() Provider { return NewMemcachedProvider(server.client(), nil) })
+}
+
+func TestMemcachedProviderSaveAfterDestroy(t *testing.T) {
+	testSaveAfterDestroy(t, NewMemcachedProvider(newFakeMemcached(t).client(), nil))
+}
+
+func TestMemcachedProviderRegenerateKeepsTheMaxAge(t *testing.T) {
+	server := newFakeMemcached(t)
+	p := NewMemcachedProvider(server.client(), nil)
+
+	p.Initialize("sid1", 600)
+	p.Read("sid1", 600)
+	p.Regenerate("sid1", "sid2")
+
+	if expiration := server.expiration(p.key("sid2")); expiration != 600 {
+		t.Errorf("moved session expires after %d seconds, want 600", expiration)
+	}
+}
+
+func TestMemcachedProviderReadErrorKeepsTheItem(t *testing.T) {
+	server := newFakeMemcached(t)
+	p := NewMemcachedProvider(server.client(), nil)
+
+	store := p.Initialize("sid1", 3600)
+	store.Set("user_id", 42)
+	if err := p.Save(store); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	saved := string(server.value(p.key("sid1")))
+
+	server.setFailGets(true)
+	failed := p.Read("sid1", 3600)
+	if failed.Has("user_id") {
+		t.Error("the failed read returned the values")
+	}
+
+	failed.Set("user_id", 7)
+	if err := p.Save(failed); err != nil {
+		t.Errorf("Save of the failed read: %v", err)
+	}
+	if string(server.value(p.key("sid1"))) != saved {
+		t.Error("the failed read changed the stored session")
+	}
+
+	server.setFailGets(false)
+	if data, _ := p.Read("sid1", 3600).Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v once Memcached recovered, want 42", data)
+	}
+}
+
+func TestMemcachedProviderRegenerateKeepsTheMaxAgeOfItsConfig(t *testing.T) {
+	server := newFakeMemcached(t)
+	p := NewMemcachedProvider(server.client(), nil)
+	short := newTestManager(t, p, func(cfg *Config) { cfg.MaxAge = 60 })
+	long := newTestManager(t, p, func(cfg *Config) { cfg.MaxAge = 604800 })
+
+	_, w := startRequest(short)
+	startRequest(long)
+
+	rs, _ := startRequest(short, responseCookie(w, "sid"))
+	startRequest(long)
+	rs.Regenerate(httptest.NewRecorder())
+
+	if expiration := server.expiration(p.key(rs.ID())); expiration != 60 {
+		t.Errorf("regenerated session expires after %d seconds, want the 60 of its config", expiration)
+	}
+}
+
+func TestMemcachedProviderRegenerateFailedCopyDeletesTheOldKey(t *testing.T) {
+	server := newFakeMemcached(t)
+	p := NewMemcachedProvider(server.client(), nil)
+
+	store := p.Initialize("sid1", 600)
+	store.Set("user_id", 42)
+	if err := p.Save(store); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	server.setFailAdds(true)
+	p.Regenerate("sid1", "sid2")
+	server.setFailAdds(false)
+
+	if p.Exists("sid1") {
+		t.Error("the old id survived the failed copy")
+	}
+	if expiration := server.expiration(p.key("sid2")); expiration != 600 {
+		t.Errorf("moved session expires after %d seconds, want 600", expiration)
+	}
+	if data, _ := p.Read("sid2", 600).Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v under the new id, want 42", data)
+	}
+}
@@ -0,0 +1,113 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+)
+
+// contextKey is the request context key holding the session
+type contextKey struct{}
+
+// WithSession wraps next with the Middleware of a session configured by cfg.
+// panics if cfg names a provider that is not registered
+func WithSession(cfg *Config, next http.Handler) http.HandlerFunc {
+	return MustNew(cfg).Middleware(next).ServeHTTP
+}
+
+// Middleware wraps next so that each request starts the session, carries it in the
+// request context (see FromContext), commits it before the response header is
+// written and saves it once next returns, if it changed.
+// The save also runs when next panics, before the panic carries on up the stack
+func (s *Session) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rs := s.Start(w, req)
+
+		cw := &commitWriter{ResponseWriter: w, session: rs}
+		defer func() {
+			cw.commit()
+			rs.flush()
+		}()
+
+		next.ServeHTTP(cw, req.WithContext(NewContext(req.Context(), rs)))
+	})
+}
+
+// commitWriter commits the session right before the response header is written
+type commitWriter struct {
+	http.ResponseWriter
+	session   *Session
+	committed bool
+}
+
+func (w *commitWriter) WriteHeader(code int) {
+	w.commit()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *commitWriter) Write(b []byte) (int, error) {
+	w.commit()
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush commits the session and flushes the wrapped ResponseWriter, e.g. for server-sent events
+func (w *commitWriter) Flush() {
+	w.commit()
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Hijack commits the session and hijacks the connection of the wrapped ResponseWriter,
+// e.g. for WebSocket upgrades
+func (w *commitWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.commit()
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController
+func (w *commitWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *commitWriter) commit() {
+	if w.committed {
+		return
+	}
+
+	w.committed = true
+	if err := w.session.Commit(w.ResponseWriter); err != nil {
+		w.session.logf("session: committing session: %v", err)
+	}
+}
+
+// NewContext returns a copy of ctx carrying the session
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, s)
+}
+
+// FromContext returns the session carried by ctx, if any
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(contextKey{}).(*Session)
+	return s, ok
+}
+
+// flush saves the session if its store is dirty, logging errors
+func (s *Session) flush() {
+	if s.store == nil || s.destroyed || s.expired || s.readOnly {
+		return
+	}
+
+	if d, ok := s.store.(interface{ Dirty() bool }); ok && !d.Dirty() {
+		return
+	}
+
+	if err := s.checkSize(); err != nil {
+		s.logf("session: saving session: %v", err)
+		return
+	}
+
+	// the handler is done, a client going away must not cancel the save
+	if err := s.providerSave(context.WithoutCancel(s.context())); err != nil {
+		s.logf("session: saving session: %v", err)
+	}
+}
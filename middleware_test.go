@@ -0,0 +1,208 @@
+package session
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fileSessionConfig returns a configuration storing sessions in dir
+func fileSessionConfig(dir string) *Config {
+	return &Config{
+		Key:              "sid",
+		MaxAge:           3600,
+		ProviderInstance: NewFileProvider(dir),
+		ErrorLog:         log.New(io.Discard, "", 0),
+	}
+}
+
+func TestWithSession(t *testing.T) {
+	dir := t.TempDir()
+	handler := WithSession(fileSessionConfig(dir), http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rs, ok := FromContext(req.Context())
+		if !ok {
+			t.Fatal("no session in the request context")
+		}
+		rs.Set("user_id", 42)
+		w.Write([]byte("hello"))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	cookie := responseCookie(w, "sid")
+	if cookie == nil {
+		t.Fatal("no session cookie sent")
+	}
+	if w.Body.String() != "hello" {
+		t.Errorf("body = %q, want hello", w.Body.String())
+	}
+	if data, _ := NewFileProvider(dir).Read(cookie.Value, 3600).Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v once the handler returned, want it saved", data)
+	}
+}
+
+func TestWithSessionPanickingHandler(t *testing.T) {
+	dir := t.TempDir()
+	handler := WithSession(fileSessionConfig(dir), http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rs, _ := FromContext(req.Context())
+		rs.Set("user_id", 42)
+		panic("handler failed")
+	}))
+
+	w := httptest.NewRecorder()
+	func() {
+		defer func() {
+			if recover() != "handler failed" {
+				t.Error("the panic did not carry on up the stack")
+			}
+		}()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+
+	cookie := responseCookie(w, "sid")
+	if cookie == nil {
+		t.Fatal("no session cookie sent")
+	}
+	if data, _ := NewFileProvider(dir).Read(cookie.Value, 3600).Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v after the panic, want it saved", data)
+	}
+}
+
+func TestMiddlewareExpire(t *testing.T) {
+	t.Run("cookie", func(t *testing.T) {
+		testMiddlewareExpire(t, NewCookieProvider([]byte("0123456789abcdef0123456789abcdef"), nil), false)
+	})
+	t.Run("memory", func(t *testing.T) {
+		testMiddlewareExpire(t, NewMemoryProvider(), true)
+	})
+}
+
+// testMiddlewareExpire checks that a session expired by a handler is not sent nor saved
+// again, and that the next request starts over with an empty session. With revocable
+// the provider must also refuse the expired session when its old cookie is replayed,
+// which a cookie carrying the whole session can not be
+func testMiddlewareExpire(t *testing.T, provider Provider, revocable bool) {
+	m := newTestManager(t, provider, nil)
+
+	login := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rs, _ := FromContext(req.Context())
+		rs.Set("user_id", 42)
+	}))
+	w := httptest.NewRecorder()
+	login.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	cookie := responseCookie(w, "sid")
+	if cookie == nil || cookie.MaxAge <= 0 {
+		t.Fatalf("login cookie = %v, want a session cookie", cookie)
+	}
+
+	logout := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rs, _ := FromContext(req.Context())
+		if data, _ := rs.Get("user_id"); data != 42 {
+			t.Errorf("user_id = %v, want 42", data)
+		}
+
+		rs.Expire(w)
+		rs.Set("locale", "fr")
+		w.Write([]byte("bye"))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	w = httptest.NewRecorder()
+	logout.ServeHTTP(w, req)
+
+	deleted := responseCookie(w, "sid")
+	if deleted == nil || deleted.MaxAge >= 0 {
+		t.Fatalf("last cookie = %v, want the session cookie deleted", deleted)
+	}
+
+	fresh := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rs, _ := FromContext(req.Context())
+		if keys := rs.Keys(); len(keys) != 0 {
+			t.Errorf("Keys = %v after Expire, want a fresh empty session", keys)
+		}
+	}))
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(deleted)
+	fresh.ServeHTTP(httptest.NewRecorder(), req)
+
+	if revocable {
+		req = httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookie)
+		fresh.ServeHTTP(httptest.NewRecorder(), req)
+
+		if store := provider.Read(cookie.Value, 3600); store.Has("user_id") || store.Has("locale") {
+			t.Error("Read of the expired session returned its values")
+		}
+	}
+}
+
+func TestMiddlewareFlush(t *testing.T) {
+	m := newTestManager(t, NewCookieProvider([]byte("0123456789abcdef0123456789abcdef"), nil), nil)
+
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rs, _ := FromContext(req.Context())
+		rs.Set("user_id", 42)
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			t.Fatal("the response writer does not implement http.Flusher")
+		}
+		flusher.Flush()
+		w.Header().Set("X-After-Flush", "1")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if !w.Flushed {
+		t.Error("the response was not flushed")
+	}
+	if responseCookie(w, "sid") == nil {
+		t.Error("the session was not committed before the flush")
+	}
+}
+
+func TestMiddlewareHijack(t *testing.T) {
+	p := NewMemoryProvider()
+	m := newTestManager(t, p, nil)
+
+	sids := make(chan string, 1)
+	server := httptest.NewServer(m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		rs, _ := FromContext(req.Context())
+		rs.Set("user_id", 42)
+		sids <- rs.ID()
+
+		hijacker, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("the response writer does not implement http.Hijacker")
+			return
+		}
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			t.Errorf("Hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+		buf.Flush()
+	})))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("status = %d, want 101", resp.StatusCode)
+	}
+	if data, _ := p.Read(<-sids, 3600).Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v, want the session of the hijacked request saved", data)
+	}
+}
@@ -0,0 +1,62 @@
+package session
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// Portable is implemented by providers able to export a single session
+// and import it into another provider instance, e.g. to reproduce an issue in staging
+type Portable interface {
+	// ExportSession serializes the session with passed id along with its metadata
+	ExportSession(sid string) ([]byte, error)
+	// ImportSession stores an exported session under sid, replacing any existing one
+	ImportSession(sid string, data []byte) error
+}
+
+// exportedSession is the serialized form of a session moved between providers
+type exportedSession struct {
+	CreatedAt      int64
+	LastAccessedAt int64
+	MaxAge         int64
+	Values         map[string]interface{}
+}
+
+func encodeExport(e *exportedSession) ([]byte, error) {
+	e.Values = persisted(e.Values)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(e); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeExport(data []byte) (*exportedSession, error) {
+	e := &exportedSession{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(e); err != nil {
+		return nil, err
+	}
+
+	if e.Values == nil {
+		e.Values = make(map[string]interface{})
+	}
+
+	return e, nil
+}
+
+// Redact removes the listed keys from an exported session,
+// so sensitive values do not leave the environment they were exported from
+func Redact(data []byte, keys ...string) ([]byte, error) {
+	e, err := decodeExport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		delete(e.Values, key)
+	}
+
+	return encodeExport(e)
+}
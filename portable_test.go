@@ -0,0 +1,61 @@
+package session
+
+import "testing"
+
+func TestExportImportSession(t *testing.T) {
+	prod := NewMemoryProvider()
+	store := prod.Initialize("sid1", 3600).(*MemorySessionStore)
+	store.SetMany(map[string]interface{}{"user_id": 42, "locale": "fr", "token": "secret"})
+	store.Lock()
+	store.createdAt -= 600
+	store.Unlock()
+
+	var p Portable = prod
+	data, err := p.ExportSession("sid1")
+	if err != nil {
+		t.Fatalf("ExportSession: %v", err)
+	}
+
+	staging := NewMemoryProvider()
+	if err := staging.ImportSession("debug1", data); err != nil {
+		t.Fatalf("ImportSession: %v", err)
+	}
+
+	imported := staging.Read("debug1", 3600).(*MemorySessionStore)
+	for key, want := range store.Snapshot() {
+		if data, _ := imported.Get(key); data != want {
+			t.Errorf("%s = %v after import, want %v", key, data, want)
+		}
+	}
+	if !imported.CreatedAt().Equal(store.CreatedAt()) {
+		t.Errorf("created at %v after import, want %v", imported.CreatedAt(), store.CreatedAt())
+	}
+
+	if _, err := prod.ExportSession("missing"); err == nil {
+		t.Error("exporting a missing session succeeded")
+	}
+	if err := staging.ImportSession("debug2", []byte("garbage")); err == nil {
+		t.Error("importing garbage succeeded")
+	}
+}
+
+func TestRedactExport(t *testing.T) {
+	prod := NewMemoryProvider()
+	prod.Initialize("sid1", 3600).SetMany(map[string]interface{}{"user_id": 42, "token": "secret"})
+
+	data, _ := prod.ExportSession("sid1")
+	redacted, err := Redact(data, "token")
+	if err != nil {
+		t.Fatalf("Redact: %v", err)
+	}
+
+	staging := NewMemoryProvider()
+	staging.ImportSession("sid1", redacted)
+	store := staging.Read("sid1", 3600)
+	if store.Has("token") {
+		t.Error("the redacted key was imported")
+	}
+	if data, _ := store.Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v, want 42", data)
+	}
+}
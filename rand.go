@@ -0,0 +1,41 @@
+package session
+
+import (
+	"crypto/rand"
+	"io"
+)
+
+// alphabet is the set of characters used in generated session ids
+const alphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// RandReader is the source of randomness for session ids and tokens.
+// It defaults to crypto/rand.Reader and must only be replaced in tests,
+// e.g. with a fixed reader to produce predictable ids
+var RandReader io.Reader = rand.Reader
+
+// randomString returns a random string of n characters drawn from alphabet
+func randomString(n int) (string, error) {
+	// bytes at or above limit are discarded so every character is equally likely
+	const limit = 256 - 256%len(alphabet)
+
+	out := make([]byte, 0, n)
+	buf := make([]byte, n)
+	for len(out) < n {
+		if _, err := io.ReadFull(RandReader, buf); err != nil {
+			return "", err
+		}
+
+		for _, b := range buf {
+			if int(b) >= limit {
+				continue
+			}
+
+			out = append(out, alphabet[int(b)%len(alphabet)])
+			if len(out) == n {
+				break
+			}
+		}
+	}
+
+	return string(out), nil
+}
@@ -0,0 +1,40 @@
+package session
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// withRandReader replaces RandReader with r for the rest of the test
+func withRandReader(t *testing.T, r io.Reader) {
+	t.Helper()
+
+	old := RandReader
+	RandReader = r
+	t.Cleanup(func() { RandReader = old })
+}
+
+func TestRandReaderPredictableIDs(t *testing.T) {
+	// 0xff is out of the alphabet range and skipped
+	data := []byte{0xff}
+	for i := 0; i < 64; i++ {
+		data = append(data, byte(i))
+	}
+	withRandReader(t, bytes.NewReader(data))
+
+	rs, _ := startRequest(newTestManager(t, nil, nil))
+	if want := alphabet[:32]; rs.ID() != want {
+		t.Errorf("id = %q, want %q", rs.ID(), want)
+	}
+}
+
+func TestRandomStringReadError(t *testing.T) {
+	withRandReader(t, iotest.ErrReader(errors.New("no entropy")))
+
+	if s, err := randomString(32); err == nil {
+		t.Errorf("randomString = %q, want the read error", s)
+	}
+}
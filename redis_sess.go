@@ -0,0 +1,241 @@
+package session
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type (
+	// RedisProvider stores sessions in Redis, each gob encoded under its own key
+	// with a TTL equal to the session max age. Reads and saves refresh the TTL.
+	// Changes are written to Redis in a single SET when the store is saved
+	//
+	// Register it to select it by name in Config.Provider:
+	//
+	//	session.RegisterProvider("redis", session.NewRedisProvider(client, nil))
+	RedisProvider struct {
+		client        redis.UniversalClient
+		prefix        string
+		timeout       time.Duration
+		defaultMaxAge int64
+		codec         Codec
+	}
+
+	// RedisOptions configures a RedisProvider
+	RedisOptions struct {
+		// Prefix is prepended to the session id to build keys, defaults to "session:"
+		Prefix string
+		// Timeout bounds every Redis command, defaults to 5 seconds
+		Timeout time.Duration
+		// DefaultMaxAge is the TTL in seconds of sessions created by Regenerate
+		// when the old session is gone, defaults to 86400
+		DefaultMaxAge int64
+		// Codec serializes session values, defaults to GobCodec.
+		// Use an EncryptedCodec to encrypt sessions at rest
+		Codec Codec
+	}
+)
+
+// NewRedisProvider returns a provider storing sessions through client.
+// opts may be nil to use the defaults
+func NewRedisProvider(client redis.UniversalClient, opts *RedisOptions) *RedisProvider {
+	p := &RedisProvider{
+		client:        client,
+		prefix:        "session:",
+		timeout:       5 * time.Second,
+		defaultMaxAge: 86400,
+		codec:         defaultCodec,
+	}
+
+	if opts != nil {
+		if opts.Prefix != "" {
+			p.prefix = opts.Prefix
+		}
+		if opts.Timeout > 0 {
+			p.timeout = opts.Timeout
+		}
+		if opts.DefaultMaxAge > 0 {
+			p.defaultMaxAge = opts.DefaultMaxAge
+		}
+		if opts.Codec != nil {
+			p.codec = opts.Codec
+		}
+	}
+
+	return p
+}
+
+// Read fetches the session from Redis and refreshes its TTL.
+// If the session does not exist or can not be decoded or decrypted, a new one is created and returned.
+// If the GET fails the error is logged and an empty store is returned that is never saved,
+// leaving the key as is
+func (p *RedisProvider) Read(sid string, maxAge int64) Store {
+	return p.ReadContext(context.Background(), sid, maxAge)
+}
+
+// ReadContext is like Read, bounding the Redis commands by ctx as well as the provider timeout
+func (p *RedisProvider) ReadContext(ctx context.Context, sid string, maxAge int64) Store {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	data, err := p.client.Get(ctx, p.key(sid)).Bytes()
+	if err == redis.Nil {
+		return p.InitializeContext(ctx, sid, maxAge)
+	}
+	if err != nil {
+		// a failing Redis must not wipe the session, only this request goes without it
+		log.Printf("session: reading session: %v", err)
+		return newMemoryStore(sid, make(map[string]interface{}))
+	}
+
+	values, err := p.codec.Unmarshal(data)
+	if err != nil {
+		return p.InitializeContext(ctx, sid, maxAge)
+	}
+
+	ttl := redisTTL(maxAge)
+	if ttl > 0 {
+		p.client.Expire(ctx, p.key(sid), ttl)
+	}
+
+	return p.store(sid, values, ttl)
+}
+
+// Initialize creates an empty session in Redis expiring after maxAge seconds
+func (p *RedisProvider) Initialize(sid string, maxAge int64) Store {
+	return p.InitializeContext(context.Background(), sid, maxAge)
+}
+
+// InitializeContext is like Initialize, bounding the Redis commands by ctx
+func (p *RedisProvider) InitializeContext(ctx context.Context, sid string, maxAge int64) Store {
+	store := p.store(sid, make(map[string]interface{}), redisTTL(maxAge))
+	store.create(ctx)
+	return store
+}
+
+// Exists checks if a session with passed id exists
+func (p *RedisProvider) Exists(sid string) bool {
+	return p.ExistsContext(context.Background(), sid)
+}
+
+// ExistsContext is like Exists, bounding the Redis commands by ctx
+func (p *RedisProvider) ExistsContext(ctx context.Context, sid string) bool {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	n, err := p.client.Exists(ctx, p.key(sid)).Result()
+	return err == nil && n > 0
+}
+
+// Regenerate renames the session key to the new id, keeping its values and TTL.
+// If the rename fails the error is logged, the old key deleted and the values read
+// set under the new id with a TTL of DefaultMaxAge
+func (p *RedisProvider) Regenerate(oldsid string, sid string) Store {
+	return p.RegenerateContext(context.Background(), oldsid, sid)
+}
+
+// RegenerateContext is like Regenerate, bounding the Redis commands by ctx
+func (p *RedisProvider) RegenerateContext(ctx context.Context, oldsid string, sid string) Store {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	data, err := p.client.Get(ctx, p.key(oldsid)).Bytes()
+	if err == redis.Nil {
+		return p.InitializeContext(ctx, sid, p.defaultMaxAge)
+	}
+	if err != nil {
+		// the old id must not stay usable, Session carries the values over
+		log.Printf("session: reading session: %v", err)
+		p.client.Del(ctx, p.key(oldsid))
+		return p.InitializeContext(ctx, sid, p.defaultMaxAge)
+	}
+
+	values, err := p.codec.Unmarshal(data)
+	if err != nil {
+		p.client.Del(ctx, p.key(oldsid))
+		return p.InitializeContext(ctx, sid, p.defaultMaxAge)
+	}
+
+	if err := p.client.Rename(ctx, p.key(oldsid), p.key(sid)).Err(); err != nil {
+		log.Printf("session: moving session: %v", err)
+		p.client.Del(ctx, p.key(oldsid))
+
+		store := p.store(sid, values, redisTTL(p.defaultMaxAge))
+		store.create(ctx)
+		return store
+	}
+
+	return p.store(sid, values, redis.KeepTTL)
+}
+
+// Save writes the store to Redis if it changed since it was read or last saved
+func (p *RedisProvider) Save(store Store) error {
+	return p.SaveContext(context.Background(), store)
+}
+
+// SaveContext is like Save, bounding the Redis commands by ctx
+func (p *RedisProvider) SaveContext(ctx context.Context, store Store) error {
+	return saveSynced(ctx, store)
+}
+
+// Touch refreshes the TTL of the session key to maxAge seconds
+func (p *RedisProvider) Touch(sid string, maxAge int64) {
+	ttl := redisTTL(maxAge)
+	if ttl <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	p.client.Expire(ctx, p.key(sid), ttl)
+}
+
+// Destroy deletes the session key
+func (p *RedisProvider) Destroy(sid string) {
+	p.DestroyContext(context.Background(), sid)
+}
+
+// DestroyContext is like Destroy, bounding the Redis commands by ctx
+func (p *RedisProvider) DestroyContext(ctx context.Context, sid string) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	p.client.Del(ctx, p.key(sid))
+}
+
+// store returns a store saving its values to the key of sid with expiration ttl.
+// Only creating the session sets a missing key, saving never recreates a key destroyed meanwhile
+func (p *RedisProvider) store(sid string, values map[string]interface{}, ttl time.Duration) *syncedStore {
+	return newSyncedStore(sid, values, func(ctx context.Context, values map[string]interface{}, create bool) error {
+		data, err := p.codec.Marshal(values)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+
+		if create {
+			return p.client.Set(ctx, p.key(sid), data, ttl).Err()
+		}
+
+		return p.client.SetXX(ctx, p.key(sid), data, ttl).Err()
+	})
+}
+
+func (p *RedisProvider) key(sid string) string {
+	return storageKey(p.prefix, sid)
+}
+
+// redisTTL converts a max age in seconds to a key expiration, zero meaning none
+func redisTTL(maxAge int64) time.Duration {
+	if maxAge <= 0 {
+		return 0
+	}
+
+	return time.Duration(maxAge) * time.Second
+}
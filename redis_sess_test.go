@@ -0,0 +1,224 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// fakeRedis is an in-memory stand-in for the Redis commands RedisProvider uses.
+// The other commands of the embedded nil client panic
+type fakeRedis struct {
+	redis.UniversalClient
+
+	mu   sync.Mutex
+	data map[string]string
+	ttls map[string]time.Duration
+	// getErr and renameErr, when set, fail every GET or RENAME
+	getErr, renameErr error
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{data: make(map[string]string), ttls: make(map[string]time.Duration)}
+}
+
+func (r *fakeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.getErr != nil {
+		return redis.NewStringResult("", r.getErr)
+	}
+
+	data, ok := r.data[key]
+	if !ok {
+		return redis.NewStringResult("", redis.Nil)
+	}
+
+	return redis.NewStringResult(data, nil)
+}
+
+func (r *fakeRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.set(key, value, expiration)
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (r *fakeRedis) SetXX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.data[key]; !ok {
+		return redis.NewBoolResult(false, nil)
+	}
+
+	r.set(key, value, expiration)
+	return redis.NewBoolResult(true, nil)
+}
+
+// setGetErr makes every GET fail with err, or succeed again if nil
+func (r *fakeRedis) setGetErr(err error) {
+	r.mu.Lock()
+	r.getErr = err
+	r.mu.Unlock()
+}
+
+// setRenameErr makes every RENAME fail with err, or succeed again if nil
+func (r *fakeRedis) setRenameErr(err error) {
+	r.mu.Lock()
+	r.renameErr = err
+	r.mu.Unlock()
+}
+
+// set stores value under key, the caller must hold the lock
+func (r *fakeRedis) set(key string, value interface{}, expiration time.Duration) {
+	switch v := value.(type) {
+	case []byte:
+		r.data[key] = string(v)
+	case string:
+		r.data[key] = v
+	}
+
+	if expiration != redis.KeepTTL {
+		r.ttls[key] = expiration
+	}
+}
+
+func (r *fakeRedis) Rename(ctx context.Context, key, newkey string) *redis.StatusCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.renameErr != nil {
+		return redis.NewStatusResult("", r.renameErr)
+	}
+
+	data, ok := r.data[key]
+	if !ok {
+		return redis.NewStatusResult("", redis.Nil)
+	}
+
+	r.data[newkey], r.ttls[newkey] = data, r.ttls[key]
+	delete(r.data, key)
+	delete(r.ttls, key)
+	return redis.NewStatusResult("OK", nil)
+}
+
+func (r *fakeRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := int64(0)
+	for _, key := range keys {
+		if _, ok := r.data[key]; ok {
+			delete(r.data, key)
+			delete(r.ttls, key)
+			n++
+		}
+	}
+
+	return redis.NewIntResult(n, nil)
+}
+
+func (r *fakeRedis) Exists(ctx context.Context, keys ...string) *redis.IntCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := int64(0)
+	for _, key := range keys {
+		if _, ok := r.data[key]; ok {
+			n++
+		}
+	}
+
+	return redis.NewIntResult(n, nil)
+}
+
+func (r *fakeRedis) Expire(ctx context.Context, key string, expiration time.Duration) *redis.BoolCmd {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.data[key]; !ok {
+		return redis.NewBoolResult(false, nil)
+	}
+
+	r.ttls[key] = expiration
+	return redis.NewBoolResult(true, nil)
+}
+
+func TestRedisProviderRegenerateReload(t *testing.T) {
+	client := newFakeRedis()
+	testRegenerateReload(t, func() Provider { return NewRedisProvider(client, nil) })
+}
+
+func TestRedisProviderSaveAfterDestroy(t *testing.T) {
+	testSaveAfterDestroy(t, NewRedisProvider(newFakeRedis(), nil))
+}
+
+func TestRedisProviderReadErrorKeepsTheKey(t *testing.T) {
+	client := newFakeRedis()
+	p := NewRedisProvider(client, nil)
+
+	store := p.Initialize("sid1", 3600)
+	store.Set("user_id", 42)
+	if err := p.Save(store); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	saved := client.data[p.key("sid1")]
+
+	client.setGetErr(errors.New("i/o timeout"))
+	failed := p.Read("sid1", 3600)
+	if failed.Has("user_id") {
+		t.Error("the failed read returned the values")
+	}
+
+	failed.Set("user_id", 7)
+	if err := p.Save(failed); err != nil {
+		t.Errorf("Save of the failed read: %v", err)
+	}
+	if client.data[p.key("sid1")] != saved {
+		t.Error("the failed read changed the stored session")
+	}
+
+	client.setGetErr(nil)
+	if data, _ := p.Read("sid1", 3600).Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v once Redis recovered, want 42", data)
+	}
+}
+
+func TestRedisProviderRegenerateKeepsTheValues(t *testing.T) {
+	for name, renameErr := range map[string]error{
+		"renamed":       nil,
+		"rename failed": errors.New("CROSSSLOT Keys in request don't hash to the same slot"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			client := newFakeRedis()
+			p := NewRedisProvider(client, nil)
+
+			store := p.Initialize("sid1", 3600)
+			store.Set("user_id", 42)
+			if err := p.Save(store); err != nil {
+				t.Fatalf("Save: %v", err)
+			}
+
+			client.setRenameErr(renameErr)
+			moved := p.Regenerate("sid1", "sid2")
+			client.setRenameErr(nil)
+
+			if data, _ := moved.Get("user_id"); data != 42 {
+				t.Errorf("user_id = %v in the moved store, want 42", data)
+			}
+			if p.Exists("sid1") {
+				t.Error("the old id survived Regenerate")
+			}
+			if data, _ := p.Read("sid2", 3600).Get("user_id"); data != 42 {
+				t.Errorf("user_id = %v under the new id, want 42", data)
+			}
+		})
+	}
+}
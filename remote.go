@@ -0,0 +1,90 @@
+package session
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+)
+
+// storageKey returns the backend key of a session.
+// The sid is escaped so that it can never contain the separator ending prefix,
+// nor forge the escaping itself, making keys of distinct sids distinct
+func storageKey(prefix, sid string) string {
+	var b strings.Builder
+	b.Grow(len(prefix) + len(sid))
+	b.WriteString(prefix)
+
+	const hex = "0123456789ABCDEF"
+	for i := 0; i < len(sid); i++ {
+		c := sid[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' {
+			b.WriteByte(c)
+			continue
+		}
+
+		b.WriteByte('%')
+		b.WriteByte(hex[c>>4])
+		b.WriteByte(hex[c&0xf])
+	}
+
+	return b.String()
+}
+
+// syncedStore is a MemorySessionStore saved to a backend by its provider.
+// Changes only mark it dirty, flush hands the accumulated values to save in one go.
+// save is told to create the session only until create succeeded, otherwise it must
+// not write a session that is gone from the backend, destroyed by another request
+type syncedStore struct {
+	*MemorySessionStore
+	save   func(ctx context.Context, values map[string]interface{}, create bool) error
+	saveMu sync.Mutex
+	// missing is set while the session created by create is not saved yet
+	missing bool
+}
+
+func newSyncedStore(sid string, values map[string]interface{}, save func(ctx context.Context, values map[string]interface{}, create bool) error) *syncedStore {
+	return &syncedStore{MemorySessionStore: newMemoryStore(sid, values), save: save}
+}
+
+// flush saves the values if they changed since the last flush. Flushes are
+// serialized so that a slower save can not overwrite the values of a later one.
+// A failed save leaves the store dirty
+func (s *syncedStore) flush(ctx context.Context) error {
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
+
+	values, dirty := s.takeDirty()
+	if !dirty {
+		return nil
+	}
+
+	if err := s.save(ctx, values, s.missing); err != nil {
+		s.markDirty()
+		return err
+	}
+
+	s.missing = false
+	return nil
+}
+
+// create saves a new, empty session right away so it exists in the backend
+func (s *syncedStore) create(ctx context.Context) {
+	s.saveMu.Lock()
+	s.missing = true
+	s.saveMu.Unlock()
+
+	s.markDirty()
+	if err := s.flush(ctx); err != nil {
+		log.Printf("session: saving session: %v", err)
+	}
+}
+
+// saveSynced flushes store if it was handed out by a remote provider
+func saveSynced(ctx context.Context, store Store) error {
+	if synced, ok := store.(*syncedStore); ok {
+		return synced.flush(ctx)
+	}
+
+	return nil
+}
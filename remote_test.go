@@ -0,0 +1,60 @@
+package session
+
+import "testing"
+
+func TestStorageKeyDistinct(t *testing.T) {
+	sids := []string{
+		"abc",
+		"abc:def",
+		"session:abc",
+		"abc%3Adef",
+		"abc%",
+		"abc/../def",
+		"abc\r\ndef",
+		"",
+	}
+
+	seen := make(map[string]string, len(sids))
+	for _, sid := range sids {
+		key := storageKey("session:", sid)
+		if other, ok := seen[key]; ok {
+			t.Errorf("sids %q and %q share the key %q", other, sid, key)
+		}
+		seen[key] = sid
+
+		for i := len("session:"); i < len(key); i++ {
+			if c := key[i]; c == ':' || c == '/' || c < ' ' {
+				t.Errorf("key %q of sid %q holds %q past the prefix", key, sid, c)
+			}
+		}
+	}
+
+	if storageKey("session:", "lease:abc") == storageKey("session:lease:", "abc") {
+		t.Error("a sid holding the separator collides with the key of another prefix")
+	}
+	if key := storageKey("session:", "AZaz09-_."); key != "session:AZaz09-_." {
+		t.Errorf("key = %q, want the sid unescaped", key)
+	}
+}
+
+func TestProvidersKeepSeparatedSIDsApart(t *testing.T) {
+	for name, p := range map[string]Provider{
+		"redis": NewRedisProvider(newFakeRedis(), nil),
+		"etcd":  NewEtcdProvider(newFakeEtcd().client(), nil),
+		"file":  NewFileProvider(t.TempDir()),
+	} {
+		for _, sid := range []string{"a:b", "a%3Ab"} {
+			store := p.Initialize(sid, 3600)
+			store.Set("owner", sid)
+			if err := p.Save(store); err != nil {
+				t.Fatalf("%s: Save: %v", name, err)
+			}
+		}
+
+		for _, sid := range []string{"a:b", "a%3Ab"} {
+			if data, _ := p.Read(sid, 3600).Get("owner"); data != sid {
+				t.Errorf("%s: session %q holds the values of %v", name, sid, data)
+			}
+		}
+	}
+}
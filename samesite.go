@@ -0,0 +1,77 @@
+package session
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// User-Agent patterns from the Chromium list of clients incompatible with SameSite=None
+// https://www.chromium.org/updates/same-site/incompatible-clients
+var (
+	iosVersionRe         = regexp.MustCompile(`\(iP.+; CPU .*OS (\d+)[_\d]*.*\) AppleWebKit/`)
+	macosxVersionRe      = regexp.MustCompile(`\(Macintosh;.*Mac OS X (\d+)_(\d+)[_\d]*.*\) AppleWebKit/`)
+	safariRe             = regexp.MustCompile(`Version/.* Safari/`)
+	macEmbeddedBrowserRe = regexp.MustCompile(`^Mozilla/[\.\d]+ \(Macintosh;.*Mac OS X [_\d]+\) AppleWebKit/[\.\d]+ \(KHTML, like Gecko\)$`)
+	chromiumRe           = regexp.MustCompile(`Chrom(e|ium)`)
+	chromiumVersionRe    = regexp.MustCompile(`Chrom[^ /]+/(\d+)[\.\d]* `)
+	ucBrowserRe          = regexp.MustCompile(`UCBrowser/`)
+	ucBrowserVersionRe   = regexp.MustCompile(`UCBrowser/(\d+)\.(\d+)\.(\d+)[\.\d]* `)
+)
+
+// sameSiteNoneIncompatible reports whether the client identified by the
+// User-Agent is known to reject or mishandle cookies carrying SameSite=None
+func sameSiteNoneIncompatible(ua string) bool {
+	return hasWebKitSameSiteBug(ua) || dropsUnrecognizedSameSiteCookies(ua)
+}
+
+func hasWebKitSameSiteBug(ua string) bool {
+	if m := iosVersionRe.FindStringSubmatch(ua); m != nil && m[1] == "12" {
+		return true
+	}
+
+	m := macosxVersionRe.FindStringSubmatch(ua)
+	if m == nil || m[1] != "10" || m[2] != "14" {
+		return false
+	}
+
+	isSafari := safariRe.MatchString(ua) && !chromiumRe.MatchString(ua)
+	return isSafari || macEmbeddedBrowserRe.MatchString(ua)
+}
+
+func dropsUnrecognizedSameSiteCookies(ua string) bool {
+	if ucBrowserRe.MatchString(ua) {
+		return !ucBrowserVersionAtLeast(ua, 12, 13, 2)
+	}
+
+	if !chromiumRe.MatchString(ua) {
+		return false
+	}
+
+	m := chromiumVersionRe.FindStringSubmatch(ua)
+	if m == nil {
+		return false
+	}
+
+	major, _ := strconv.Atoi(m[1])
+	return major >= 51 && major < 67
+}
+
+func ucBrowserVersionAtLeast(ua string, major, minor, build int) bool {
+	m := ucBrowserVersionRe.FindStringSubmatch(ua)
+	if m == nil {
+		return false
+	}
+
+	version := [3]int{}
+	for i := range version {
+		version[i], _ = strconv.Atoi(m[i+1])
+	}
+
+	if version[0] != major {
+		return version[0] > major
+	}
+	if version[1] != minor {
+		return version[1] > minor
+	}
+	return version[2] >= build
+}
@@ -0,0 +1,55 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSameSiteNoneIncompatible(t *testing.T) {
+	for ua, want := range map[string]bool{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 12_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.0 Mobile/15E148 Safari/604.1":                                     true,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 13_1 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0 Mobile/15E148 Safari/604.1":                                     false,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.1.2 Safari/605.1.15":                                                     true,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/605.1.15 (KHTML, like Gecko)":                                                                                    true,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/14.0 Safari/605.1.15":                                                       false,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/90.0.4430.93 Safari/537.36":                                                    false,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/60.0.3112.113 Safari/537.36":                                                         true,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/80.0.3987.149 Safari/537.36":                                                         false,
+		"Mozilla/5.0 (Linux; U; Android 8.0.0; en-US; Pixel XL Build/OPR3.170623.007) AppleWebKit/534.30 (KHTML, like Gecko) Version/4.0 UCBrowser/12.10.8.1172 Mobile Safari/534.30": true,
+		"Mozilla/5.0 (Linux; U; Android 8.0.0; en-US; Pixel XL Build/OPR3.170623.007) AppleWebKit/534.30 (KHTML, like Gecko) Version/4.0 UCBrowser/12.13.2.1172 Mobile Safari/534.30": false,
+		"Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0":                                                                                                      false,
+		"": false,
+	} {
+		if got := sameSiteNoneIncompatible(ua); got != want {
+			t.Errorf("sameSiteNoneIncompatible(%q) = %v, want %v", ua, got, want)
+		}
+	}
+}
+
+func TestSameSiteCompatCookie(t *testing.T) {
+	for _, tc := range []struct {
+		ua     string
+		compat bool
+		want   http.SameSite
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 12_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.0 Mobile/15E148 Safari/604.1", true, 0},
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 12_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.0 Mobile/15E148 Safari/604.1", false, http.SameSiteNoneMode},
+		{"Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0", true, http.SameSiteNoneMode},
+	} {
+		m := newTestManager(t, nil, func(cfg *Config) {
+			cfg.Secure = true
+			cfg.SameSite = http.SameSiteNoneMode
+			cfg.SameSiteCompat = tc.compat
+		})
+
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("User-Agent", tc.ua)
+		w := httptest.NewRecorder()
+		m.Start(w, req)
+
+		if c := responseCookie(w, "sid"); c == nil || c.SameSite != tc.want {
+			t.Errorf("compat %v, %q: cookie = %v, want SameSite %v", tc.compat, tc.ua, c, tc.want)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package session
+
+import "strings"
+
+// Scope is a view of a session that prefixes keys with a namespace, so unrelated
+// parts of an application can share a session without their keys colliding:
+//
+//	auth, cart := s.Namespace("auth"), s.Namespace("cart")
+//	auth.Set("user", user) // stored as "auth.user"
+//	cart.Set("user", guest) // stored as "cart.user"
+type Scope struct {
+	session *Session
+	prefix  string
+}
+
+// Namespace returns a view of the session whose keys are prefixed with name and a dot
+func (s *Session) Namespace(name string) *Scope {
+	return &Scope{session: s, prefix: name + "."}
+}
+
+// Namespace returns a view nested in the scope
+func (sc *Scope) Namespace(name string) *Scope {
+	return &Scope{session: sc.session, prefix: sc.prefix + name + "."}
+}
+
+// Get fetches an item of the namespace by key
+func (sc *Scope) Get(key string) (interface{}, bool) {
+	return sc.session.Get(sc.prefix + key)
+}
+
+// Has reports whether an item of the namespace is saved under key
+func (sc *Scope) Has(key string) bool {
+	return sc.session.Has(sc.prefix + key)
+}
+
+// Set adds an item to the namespace
+func (sc *Scope) Set(key string, data interface{}) {
+	sc.session.Set(sc.prefix+key, data)
+}
+
+// Remove deletes an item of the namespace by key
+func (sc *Scope) Remove(key string) {
+	sc.session.Remove(sc.prefix + key)
+}
+
+// Pull gets an item of the namespace and deletes it
+func (sc *Scope) Pull(key string) (interface{}, bool) {
+	return sc.session.Pull(sc.prefix + key)
+}
+
+// Keys returns the keys of the items in the namespace, without the prefix
+func (sc *Scope) Keys() []string {
+	var keys []string
+	for _, key := range sc.session.Keys() {
+		if strings.HasPrefix(key, sc.prefix) {
+			keys = append(keys, strings.TrimPrefix(key, sc.prefix))
+		}
+	}
+
+	return keys
+}
+
+// Clear removes the items of the namespace, leaving the rest of the session untouched
+func (sc *Scope) Clear() {
+	if !sc.session.writable() {
+		return
+	}
+
+	var keys []string
+	for _, key := range sc.session.store.Keys() {
+		if strings.HasPrefix(key, sc.prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sc.session.store.Transaction(func(tx *Tx) error {
+		for _, key := range keys {
+			tx.Remove(key)
+		}
+		clearExpiries(tx, keys...)
+		return nil
+	})
+}
@@ -1,15 +1,22 @@
 package session
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
-
-	"github.com/gochef/chef/utils"
-	"github.com/gochef/cookie"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 )
 
 type (
-	// Store represents an interface to control session object
+	// Store represents an interface to control session object.
+	// Stores implemented outside the package must also provide Has, Keys, Len, SetMany, Snapshot,
+	// CreatedAt, LastAccessed and GetOrSet, which were added to the interface; embedding
+	// *MemorySessionStore provides them
 	Store interface {
 		// Get returns an item saved in session
 		Get(key string) (interface{}, bool)
@@ -17,6 +24,33 @@ type (
 		Remove(key string)
 		Clear()
 		ID() string
+		// Modify atomically replaces the item saved under key with the result of fn
+		// and returns it. fn receives the current item and whether it exists
+		Modify(key string, fn func(data interface{}, ok bool) interface{}) interface{}
+		// Size returns the approximate serialized size of the items in bytes
+		Size() int
+		// Transaction runs fn under the write lock and applies the changes
+		// staged on tx only if fn returns nil
+		Transaction(fn func(tx *Tx) error) error
+		// Has reports whether an item is saved under key
+		Has(key string) bool
+		// Keys returns the keys of the saved items
+		Keys() []string
+		// Len returns the number of saved items
+		Len() int
+		// SetMany saves all values at once, under a single write lock
+		SetMany(values map[string]interface{})
+		// Snapshot returns a shallow copy of the saved items, consistent at a single point in time
+		Snapshot() map[string]interface{}
+		// CreatedAt returns when the session was initialized and LastAccessed when it was
+		// last read or touched. The memory provider tracks both exactly, network providers
+		// and the cookie provider do not keep them in the backend and report approximate
+		// values, when the session was loaded by this process
+		CreatedAt() time.Time
+		LastAccessed() time.Time
+		// GetOrSet returns the item saved under key, or saves and returns the result of fn
+		// if there is none, atomically: fn runs at most once per missing key
+		GetOrSet(key string, fn func() interface{}) interface{}
 	}
 
 	// Provider represents a session provider interface
@@ -26,14 +60,158 @@ type (
 		Exists(sid string) bool
 		Regenerate(oldsid string, newsid string) Store
 		Destroy(sid string)
+		// Save persists the changes made to store since it was read or last saved.
+		// Providers writing changes as they happen return nil
+		Save(store Store) error
+	}
+
+	// ContextProvider is implemented by providers talking to a backend over the network.
+	// Sessions prefer its methods to the Provider ones, passing the context of the
+	// request they were started for, so a slow or hung backend is abandoned once the
+	// request is canceled or its deadline passes instead of piling up goroutines
+	ContextProvider interface {
+		ReadContext(ctx context.Context, sid string, expires int64) Store
+		InitializeContext(ctx context.Context, sid string, expires int64) Store
+		ExistsContext(ctx context.Context, sid string) bool
+		RegenerateContext(ctx context.Context, oldsid string, newsid string) Store
+		DestroyContext(ctx context.Context, sid string)
+		SaveContext(ctx context.Context, store Store) error
+	}
+
+	// Flusher is implemented by providers holding sessions in process that may have
+	// changes not yet written to durable storage. Flush writes them all and is safe to
+	// call while requests are still served. On shutdown, first let in-flight requests
+	// finish, so Middleware saves their sessions, then flush. Providers keeping nothing
+	// in process once a request saved its session, e.g. RedisProvider, need no flush:
+	//
+	//	srv.Shutdown(ctx)
+	//	if flusher, ok := provider.(session.Flusher); ok {
+	//		if err := flusher.Flush(); err != nil {
+	//			log.Printf("flushing sessions: %v", err)
+	//		}
+	//	}
+	Flusher interface {
+		Flush() error
+	}
+
+	// Expirer is implemented by providers able to expire a session without destroying it,
+	// so that the next Read of sid yields a fresh store
+	Expirer interface {
+		Expire(sid string)
+	}
+
+	// Toucher is implemented by providers able to extend the lifetime of a session
+	// without reading or writing its values
+	Toucher interface {
+		// Touch records an access to sid, pushing its expiry back by expires seconds
+		Touch(sid string, expires int64)
+	}
+
+	// GarbageCollector is implemented by providers that remove expired sessions in the background
+	GarbageCollector interface {
+		StartGC(interval time.Duration)
+		StopGC()
+	}
+
+	// Lister is implemented by providers able to enumerate their sessions
+	Lister interface {
+		// ListSessions returns a page of at most limit sessions starting at offset,
+		// ordered by creation time, along with the total number of sessions
+		ListSessions(offset, limit int) ([]SessionInfo, int)
+	}
+
+	// Enumerator is implemented by providers able to walk their live sessions,
+	// e.g. to log a user out of every device:
+	//
+	//	provider.Each(func(sid string, store session.Store) bool {
+	//		if uid, _ := store.Get("user_id"); uid == userID {
+	//			provider.Destroy(sid)
+	//		}
+	//		return true
+	//	})
+	Enumerator interface {
+		// Count returns the number of live sessions
+		Count() int
+		// Each calls fn for every live session until fn returns false.
+		// fn may destroy or regenerate sessions
+		Each(fn func(sid string, store Store) bool)
+	}
+
+	// BulkDestroyer is implemented by providers able to destroy every session matching
+	// a predicate in one batch, e.g. when a user changes their password:
+	//
+	//	provider.DestroyWhere(func(store session.Store) bool {
+	//		uid, _ := store.Get("user_id")
+	//		return uid == userID
+	//	})
+	BulkDestroyer interface {
+		// DestroyWhere destroys the sessions whose store fn returns true for.
+		// fn must not call into the provider
+		DestroyWhere(fn func(store Store) bool)
+	}
+
+	// Regenerator is implemented by providers that create a new session when Regenerate
+	// finds the old one gone. Sessions prefer it to Regenerate, so that the new session
+	// gets their max age rather than a default of the provider
+	Regenerator interface {
+		// RegenerateWithMaxAge is Regenerate creating the session under newsid with a
+		// max age of expires seconds if oldsid is gone
+		RegenerateWithMaxAge(oldsid string, newsid string, expires int64) Store
+	}
+
+	// Invalidator is implemented by providers caching sessions in process, see NewCachingProvider.
+	// Invalidate evicts the cached copy of sid, e.g. from a subscriber to changes made by other processes
+	Invalidator interface {
+		Invalidate(sid string)
+	}
+
+	// Leaser is implemented by providers able to grant exclusive, time bounded leases on a session,
+	// e.g. for background jobs mutating it. A Redis implementation acquires a lease with
+	// SET lease:<sid> <token> NX PX <d> and releases it by deleting the key if it still holds token
+	Leaser interface {
+		// LeaseSession grants a lease on sid for d. returns false if another lease is held.
+		// release ends the lease early and is safe to call more than once
+		LeaseSession(sid string, d time.Duration) (release func(), ok bool)
+	}
+
+	// Observer receives the timing of every provider operation made by sessions, e.g. to
+	// export latency histograms and error rates. op is one of "read", "exists", "initialize",
+	// "regenerate", "destroy", "save", "touch" and "expire". err is the error returned
+	// by the provider, only saves report errors
+	Observer interface {
+		ObserveOp(op string, dur time.Duration, err error)
+	}
+
+	// ObserverFunc adapts a function to the Observer interface
+	ObserverFunc func(op string, dur time.Duration, err error)
+
+	// SessionInfo holds metadata describing a stored session
+	SessionInfo struct {
+		ID             string
+		CreatedAt      time.Time
+		LastAccessedAt time.Time
 	}
 
-	// Session represents a single session instance
+	// Session represents a single session instance.
+	// The Session returned by New holds the provider and configuration shared by all
+	// requests, Start returns a new Session holding the state of a single request
 	Session struct {
-		id       string
-		provider Provider
-		config   *Config
-		store    Store
+		ctx       context.Context
+		id        string
+		userAgent string
+		destroyed bool
+		expired   bool
+		started   bool
+		readOnly  bool
+		parent    *Session
+		provider  Provider
+		config    *Config
+		store     Store
+
+		// cookieless is set when the session id is not exchanged over the cookie
+		cookieless bool
+		// requests holds the sessions started by the manager for requests being served
+		requests *requestSessions
 	}
 
 	// Config is the session instance configuration
@@ -42,115 +220,1149 @@ type (
 		Provider     string
 		Key          string
 		CookieLength int
-		MaxAge       int64
+
+		// TokenLookup lists where requests carry the session id, by priority, as a
+		// comma-separated list of "cookie:" + Key, "header:" + name and "query:" + name,
+		// e.g. "header:X-Session-ID,cookie:sid" for API and browser clients alike.
+		// A "Bearer " prefix is stripped from header values, for Authorization.
+		// The cookie is only written to requests whose id did not come from a header or
+		// query parameter, and never if no cookie source is listed; such clients get the
+		// id of new sessions from Session.ID. Defaults to "cookie:" + Key
+		TokenLookup  string
+		tokenSources []tokenSource
+
+		// ProviderInstance, when set, is used instead of looking Provider up in the registry,
+		// e.g. an isolated NewMemoryProvider for tests or a tenant
+		ProviderInstance Provider
+
+		// MaxAge is the lifetime of sessions in seconds:
+		//   - positive values set the Max-Age of the cookie and the server-side expiry
+		//   - 0 makes a session cookie without Max-Age nor Expires, which the browser
+		//     drops when it closes. Providers keep the session until it is destroyed
+		//   - negative values are rejected by Validate
+		MaxAge int64
+
+		// IdleTimeout expires a session not used for the given duration, and AbsoluteTimeout
+		// one created longer ago, however active, forcing users to log in again. Both are
+		// tracked in the session, to the second, and checked when a request starts it: a
+		// session past either is destroyed and replaced by a fresh one. They complement
+		// MaxAge, which keeps governing the cookie and the expiry kept by the provider.
+		// With IdleTimeout set, every request records its use, so network providers save
+		// the session once per request and second. Both are disabled if 0
+		IdleTimeout     time.Duration
+		AbsoluteTimeout time.Duration
+
+		// IDGenerator, when set, returns the ids of new and regenerated sessions
+		// in place of random strings of CookieLength characters
+		IDGenerator func() (string, error)
+
+		// Rolling re-issues the session cookie with a fresh MaxAge on every request,
+		// so that active users stay logged in and only sessions idle for MaxAge expire.
+		// Providers refresh the server-side expiry when a session is read
+		Rolling bool
+
+		// GCInterval, when positive, starts the provider's garbage collector
+		// of expired sessions with this interval, see GarbageCollector
+		GCInterval time.Duration
+
+		// Signer, when set, signs the session cookie value and rejects
+		// cookies whose signature does not verify. See NewHMACSigner
+		Signer Signer
+
+		// SameSite is the SameSite attribute of the session cookie.
+		// http.SameSiteNoneMode requires Secure
+		SameSite http.SameSite
+		// SameSiteCompat omits SameSite=None for clients known to mishandle it,
+		// following the Chromium list of incompatible clients
+		SameSiteCompat bool
+		// Secure restricts the session cookie to HTTPS
+		Secure bool
+		// Path is the Path attribute of the session cookie, defaults to "/"
+		Path string
+		// Domain is the Domain attribute of the session cookie
+		Domain string
+
+		// ErrorLog specifies an optional logger for errors the session
+		// recovers from. If nil, the log package's standard logger is used
+		ErrorLog *log.Logger
+
+		// BindClientCert binds new sessions to the fingerprint of the TLS client
+		// certificate they were created with. A bound session presented with a
+		// different certificate, or none, is destroyed and replaced by a fresh one.
+		// Sessions created without a client certificate are not bound
+		BindClientCert bool
+
+		// Fingerprint, when set, binds sessions to the value it returns for the request
+		// that first uses them, e.g. ClientFingerprint. A session presented by a request
+		// with another fingerprint is destroyed and replaced by a fresh one, making stolen
+		// cookies harder to use. Only a hash of the fingerprint is stored.
+		// The more it covers the more legitimate users it logs out: mobile clients change
+		// networks, browsers update their User-Agent, and the combination of address and
+		// User-Agent is personal data in some jurisdictions
+		Fingerprint func(req *http.Request) string
+
+		// MaxAgeRounding rounds the Max-Age sent to the browser to the nearest multiple
+		// of the given duration, to make it less useful for fingerprinting. The
+		// server-side expiry keeps using MaxAge exactly
+		MaxAgeRounding time.Duration
+
+		// CookieSetter, when set, is called to emit the session cookie instead of
+		// writing the Set-Cookie header directly, for frameworks that manage cookies
+		CookieSetter func(w http.ResponseWriter, c *http.Cookie)
+
+		// CookieCodec reads and writes the session cookie, StdCookieCodec if nil.
+		// CookieSetter, when set, still takes over writing
+		CookieCodec CookieCodec
+
+		// MaxSize caps the serialized size of a session in bytes. Changes are not checked
+		// as they are made but when the session is persisted: Save, and the Middleware
+		// which logs it, fail with ErrSessionTooLarge for a session estimated larger, see
+		// Store.Size, and do not save it. With the memory provider, which holds changes
+		// live, the error only reports the overflow. For the cookie provider the limit
+		// applies to the encoded cookie value and Commit writes no cookie past it.
+		// Unlimited if 0, except for the cookie provider, always limited to 4096
+		// bytes, what browsers accept for a cookie and Start accepts back
+		MaxSize int
+
+		// OnStart, OnDestroy and OnRegenerate, when set, are called with the session
+		// ids involved whenever a request starts its session, a session is destroyed,
+		// including when Start drops a session failing its bindings, and a session
+		// moves to a new id, for auditing and metrics. They run synchronously on the
+		// request path, so they should be cheap and hand slow work off elsewhere
+		OnStart      func(sid string)
+		OnDestroy    func(sid string)
+		OnRegenerate func(oldsid, newsid string)
+
+		// Observer, when set, is told how long each provider operation took, see Observer
+		Observer Observer
 	}
 )
 
+const (
+	// maxCookieValueLength is the longest session cookie value accepted from a client
+	maxCookieValueLength = 4096
+	// defaultCookieLength is the length of generated session ids when CookieLength is unset
+	defaultCookieLength = 32
+	// reservedPrefix starts the keys the package keeps its own state under
+	reservedPrefix = "_session."
+)
+
+// ErrSessionDestroyed is reported when a destroyed session is modified
+var ErrSessionDestroyed = errors.New("session: session has been destroyed")
+
+// ErrSessionNotStarted is reported when a session that was not started, see Session.Started, is modified
+var ErrSessionNotStarted = errors.New("session: session has not been started")
+
+// ErrNotStarted is ErrSessionNotStarted, returned by the E-suffixed accessors, e.g. GetStringE,
+// on a session that was not started
+var ErrNotStarted = ErrSessionNotStarted
+
+// ErrKeyNotFound is returned by the E-suffixed accessors for a key holding no item
+var ErrKeyNotFound = errors.New("session: key not found")
+
+// ErrTypeMismatch is returned by the E-suffixed accessors for an item of another type than requested
+var ErrTypeMismatch = errors.New("session: item has another type")
+
+// ErrProviderNotRegistered is returned by New when Config.Provider names no registered provider
+var ErrProviderNotRegistered = errors.New("session: provider is not registered")
+
+// ErrProviderAlreadyRegistered is returned by RegisterProviderE for a name already in use
+var ErrProviderAlreadyRegistered = errors.New("session: provider is already registered")
+
+// ErrSessionReadOnly is reported when a session started with StartReadOnly is modified
+var ErrSessionReadOnly = errors.New("session: session is read-only")
+
+// ErrSessionTooLarge is returned when a session exceeds Config.MaxSize on Save or Commit
+var ErrSessionTooLarge = errors.New("session: session too large")
+
+// ErrMalformedCookie is reported when the session cookie sent by a client fails validation
+var ErrMalformedCookie = errors.New("session: malformed session cookie")
+
 var (
 	providers = map[string]Provider{
 		"memory": MemoryProvider,
 	}
-	
+	providersMu sync.RWMutex
+
 	ssn *Session
 )
 
-// New returns a session instance with configured provider
-func New(cfg *Config) *Session {
-	provider, ok := providers[cfg.Provider]
-	if !ok {
-		errStr := "Session Provider %s is not registered"
-		panic(fmt.Sprintf(errStr, provider))
+// ObserveOp calls f(op, dur, err)
+func (f ObserverFunc) ObserveOp(op string, dur time.Duration, err error) {
+	f(op, dur, err)
+}
+
+// New returns a session instance with configured provider.
+// returns an error if the provider is not registered
+func New(cfg *Config) (*Session, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	provider := cfg.ProviderInstance
+	if provider == nil {
+		providersMu.RLock()
+		registered, ok := providers[cfg.Provider]
+		providersMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrProviderNotRegistered, cfg.Provider)
+		}
+
+		provider = registered
+	}
+
+	if gc, ok := provider.(GarbageCollector); ok && cfg.GCInterval > 0 {
+		gc.StartGC(cfg.GCInterval)
 	}
 
 	ssn = &Session{
 		provider: provider,
 		config:   cfg,
+		requests: &requestSessions{sessions: make(map[*http.Request]*Session)},
+	}
+
+	return ssn, nil
+}
+
+// Validate checks the configuration and fills in the defaults of unset fields,
+// CookieLength 32 and Path "/". New calls it, returning its error
+func (c *Config) Validate() error {
+	if c.Key == "" {
+		return errors.New("session: Key, the name of the session cookie, is empty")
+	}
+
+	if !validCookieName(c.Key) {
+		return fmt.Errorf("session: Key %q is not a valid cookie name", c.Key)
+	}
+
+	if c.MaxAge < 0 {
+		return fmt.Errorf("session: MaxAge %d is negative, use 0 for a session cookie", c.MaxAge)
+	}
+
+	if c.IdleTimeout < 0 || c.AbsoluteTimeout < 0 {
+		return errors.New("session: IdleTimeout and AbsoluteTimeout must not be negative, use 0 to disable them")
+	}
+
+	if c.MaxSize < 0 {
+		return fmt.Errorf("session: MaxSize %d is negative, use 0 for no limit", c.MaxSize)
+	}
+
+	if c.SameSite == http.SameSiteNoneMode && !c.Secure {
+		return errors.New("session: SameSite=None requires Secure, browsers reject the cookie otherwise")
+	}
+
+	sources, err := parseTokenLookup(c.TokenLookup, c.Key)
+	if err != nil {
+		return err
 	}
+	c.tokenSources = sources
 
-	return ssn
+	if c.CookieLength <= 0 {
+		c.CookieLength = defaultCookieLength
+	}
+
+	if c.Path == "" {
+		c.Path = "/"
+	}
+
+	return nil
+}
+
+// MustNew is like New but panics if the session can not be created
+func MustNew(cfg *Config) *Session {
+	s, err := New(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+// Start starts the session of a request and returns it.
+// s is left untouched, so a Session returned by New can be shared by concurrent
+// requests while each works on its own Session. Calling Start on a started session,
+// for a request whose context already carries a session started from s, or again for
+// a request being served, e.g. by both a middleware and the handler, returns that
+// session without reading it again nor sending another cookie. The returned session
+// calls ContextProvider methods with req.Context(). If no session id can be generated
+// the error is logged and the request gets an empty session that is never stored nor
+// sent, see StartE to handle the error
+func (s *Session) Start(w http.ResponseWriter, req *http.Request) *Session {
+	rs, _ := s.StartE(w, req)
+	return rs
+}
+
+// StartE is like Start but also returns the error of the IDGenerator, or of the random
+// source, when a new session is needed and no id can be generated for it. The returned
+// session is then empty, has no id and is neither stored by the provider nor sent
+func (s *Session) StartE(w http.ResponseWriter, req *http.Request) (*Session, error) {
+	if s.started {
+		return s, nil
+	}
+	if started, ok := FromContext(req.Context()); ok && started.parent == s {
+		return started, nil
+	}
+	if started, ok := s.requests.get(req); ok {
+		return started, nil
+	}
+
+	rs := &Session{
+		ctx:       req.Context(),
+		userAgent: req.UserAgent(),
+		started:   true,
+		parent:    s,
+		provider:  s.provider,
+		config:    s.config,
+	}
+
+	err := rs.resume(w, req)
+	s.requests.add(req, rs)
+
+	if rs.config.OnStart != nil && rs.id != "" {
+		rs.config.OnStart(rs.ID())
+	}
+
+	return rs, err
 }
 
-// Start starts a session instance
-func (s *Session) Start(w http.ResponseWriter, req *http.Request) {
-	cookieValue := cookie.Get(s.config.Key, req)
+// StartReadOnly returns the session of the request if the client sent a cookie for an
+// existing one, for endpoints that must not create sessions, e.g. public pages and
+// health checks. No session is created and no cookie is written: without a valid
+// cookie the session is empty and Get misses. Set and the other modifications are
+// no-ops logging ErrSessionReadOnly, and the session is never saved
+func (s *Session) StartReadOnly(req *http.Request) *Session {
+	if s.started {
+		return s
+	}
+	if started, ok := FromContext(req.Context()); ok && started.parent == s {
+		return started
+	}
+
+	rs := &Session{
+		ctx:       req.Context(),
+		userAgent: req.UserAgent(),
+		started:   true,
+		readOnly:  true,
+		parent:    s,
+		provider:  s.provider,
+		config:    s.config,
+	}
 
+	sid := rs.readToken(req)
+	if sid == "" || !rs.providerExists(sid) {
+		return rs
+	}
+
+	rs.id = sid
+	rs.store = rs.providerRead(sid)
+	if !rs.verifyBindings(req) || rs.timedOut(time.Now().Unix()) {
+		rs.id, rs.store = "", nil
+	}
+
+	return rs
+}
+
+// requestSessions maps the requests being served to the session started for them
+type requestSessions struct {
+	sessions map[*http.Request]*Session
+	sync.Mutex
+}
+
+// get returns the session started for req
+func (r *requestSessions) get(req *http.Request) (*Session, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	rs, ok := r.sessions[req]
+	return rs, ok
+}
+
+// add records the session started for req until the request is done. Requests whose
+// context is never canceled, unlike those of net/http servers, are not recorded
+func (r *requestSessions) add(req *http.Request, rs *Session) {
+	if r == nil || req.Context().Done() == nil {
+		return
+	}
+
+	r.Lock()
+	r.sessions[req] = rs
+	r.Unlock()
+
+	context.AfterFunc(req.Context(), func() {
+		r.Lock()
+		delete(r.sessions, req)
+		r.Unlock()
+	})
+}
+
+// resume reads the session carried by the request cookie, or creates a new one
+func (s *Session) resume(w http.ResponseWriter, req *http.Request) error {
+	cookieValue := s.readToken(req)
 	if cookieValue == "" { //Empty session cookie //Start new session
-		s.id, _ = utils.RandomString(s.config.CookieLength)
-		s.store = s.provider.Initialize(s.id, s.config.MaxAge)
+		return s.initialize(w, req)
+	}
+
+	// never adopt an id the provider does not know, clients could choose it otherwise
+	if !s.providerExists(cookieValue) {
+		return s.initialize(w, req)
+	}
+
+	s.id = cookieValue
+	s.store = s.providerRead(cookieValue)
+
+	now := time.Now().Unix()
+	if !s.verifyBindings(req) || s.timedOut(now) {
+		sid := s.ID()
+		s.providerDestroy(s.id)
+		if s.config.OnDestroy != nil {
+			s.config.OnDestroy(sid)
+		}
+
+		return s.initialize(w, req)
+	}
+
+	s.recordAccess(now)
+
+	if _, ok := s.provider.(CookieEncoder); s.config.Rolling && !ok {
+		s.writeCookie(w, s.id, s.cookieMaxAge())
+	}
+
+	return nil
+}
+
+// initialize creates a new session under a fresh id and sends its cookie
+func (s *Session) initialize(w http.ResponseWriter, req *http.Request) error {
+	id, err := s.newID()
+	if err != nil {
+		// never hand out a shared empty id, the request gets a throwaway session
+		err = fmt.Errorf("session: generating session id: %w", err)
+		s.logf("%v", err)
+		s.id = ""
+		s.store = newMemoryStore("", make(map[string]interface{}))
+		return err
+	}
+
+	s.id = id
+	s.store = s.providerInitialize(s.id)
+	s.bind(req)
+	s.stamp(time.Now().Unix())
+	s.writeCookie(w, s.id, s.cookieMaxAge())
+	return nil
+}
+
+// newID returns a fresh session id from the configured IDGenerator,
+// or a random string of CookieLength characters
+func (s *Session) newID() (string, error) {
+	if s.config.IDGenerator != nil {
+		id, err := s.config.IDGenerator()
+		if err == nil && id == "" {
+			err = errors.New("IDGenerator returned an empty id")
+		}
+		return id, err
+	}
+
+	return randomString(s.config.CookieLength)
+}
+
+// cookieMaxAge returns the Max-Age of the session cookie, rounded per MaxAgeRounding
+func (s *Session) cookieMaxAge() int {
+	step := int64(s.config.MaxAgeRounding / time.Second)
+	if step <= 0 || s.config.MaxAge <= 0 {
+		return int(s.config.MaxAge)
+	}
+
+	rounded := (s.config.MaxAge + step/2) / step * step
+	if rounded == 0 {
+		rounded = step
+	}
+
+	return int(rounded)
+}
+
+// Commit sends session state that travels with the response. For providers keeping
+// the session in the cookie itself (see CookieEncoder) it re-issues the cookie with
+// the current values, so it must be called before the response is written.
+// WithSession commits automatically
+func (s *Session) Commit(w http.ResponseWriter) error {
+	enc, ok := s.provider.(CookieEncoder)
+	if !ok || s.store == nil || s.destroyed || s.expired || s.readOnly {
+		return nil
+	}
+
+	value, err := enc.EncodeCookie(s.store, s.config.MaxAge)
+	if err != nil {
+		return err
+	}
+
+	limit := s.config.MaxSize
+	if limit == 0 || limit > maxCookieValueLength {
+		limit = maxCookieValueLength
+	}
+	if len(value) > limit {
+		return fmt.Errorf("%w: cookie value is %d bytes, the limit is %d", ErrSessionTooLarge, len(value), limit)
+	}
+
+	s.writeCookie(w, value, s.cookieMaxAge())
+	return nil
+}
+
+// Save hands the store to the provider to persist the changes made during the request.
+// Middleware saves the session once the handler returns, call Save when using Start directly
+func (s *Session) Save() error {
+	if s.store == nil || s.destroyed || s.expired || s.readOnly {
+		return nil
+	}
+	if err := s.checkSize(); err != nil {
+		return err
+	}
+
+	return s.providerSave(s.context())
+}
+
+// checkSize returns ErrSessionTooLarge if the store exceeds MaxSize.
+// The cookie provider is limited on Commit, by the size of the encoded value
+func (s *Session) checkSize() error {
+	if _, ok := s.provider.(CookieEncoder); ok || s.config.MaxSize == 0 {
+		return nil
+	}
+
+	if size := s.store.Size(); size > s.config.MaxSize {
+		return fmt.Errorf("%w: %d bytes, MaxSize is %d", ErrSessionTooLarge, size, s.config.MaxSize)
+	}
+
+	return nil
+}
+
+// Destroy removes the session from the provider and expires the session cookie, logging the user out.
+// Once destroyed, reads on the session miss and writes are ignored.
+// Destroying a session that was never started or is already destroyed is a no-op
+func (s *Session) Destroy(w http.ResponseWriter) {
+	if s.id == "" || s.readOnly || s.destroyed {
+		return
+	}
+
+	sid := s.ID()
+	s.providerDestroy(s.id)
+	s.store = nil
+	s.destroyed = true
+	s.writeCookie(w, "", -1)
+
+	if s.config.OnDestroy != nil {
+		s.config.OnDestroy(sid)
+	}
+}
+
+// DeauthenticateKeeping drops every item except the listed keys and rotates the session id,
+// turning an authenticated session into an anonymous one that keeps e.g. a cart or locale
+func (s *Session) DeauthenticateKeeping(w http.ResponseWriter, keys ...string) {
+	if !s.writable() {
+		return
+	}
+
+	kept := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		kept[key] = true
+	}
+
+	s.clearExcept(kept)
+	s.Regenerate(w)
+}
+
+// Regenerate moves the session to a fresh id, keeping its values, and sends the new cookie.
+// The old id is dropped by the provider and can not be used anymore. Call it whenever
+// the privilege level changes, e.g. after login, to prevent session fixation
+func (s *Session) Regenerate(w http.ResponseWriter) {
+	if !s.writable() {
+		return
+	}
+
+	oldsid, ok := s.rotateID(w)
+	if !ok {
+		return
+	}
+
+	s.rotateCSRF()
+
+	if s.config.OnRegenerate != nil {
+		s.config.OnRegenerate(oldsid, s.ID())
+	}
+}
+
+// Renew moves the session to a fresh id if interval has passed since it last moved,
+// limiting how long any single id is valid. Unlike Regenerate it is meant to be called
+// on every request, e.g. from a middleware, and keeps everything but the id: the values,
+// the CSRF token and the expiry as kept by the provider. Unlike Touch it does not extend
+// the session. The first call on a session starts its interval
+func (s *Session) Renew(w http.ResponseWriter, interval time.Duration) {
+	if !s.writable() {
+		return
+	}
+
+	now := time.Now().Unix()
+	rotated, ok := s.store.Get(rotatedKey)
+	if !ok {
+		s.store.Set(rotatedKey, now)
+		return
+	}
+	if elapsed(rotated, now) < interval {
+		return
+	}
+
+	oldsid, ok := s.rotateID(w)
+	if !ok {
+		return
+	}
+
+	if s.config.OnRegenerate != nil {
+		s.config.OnRegenerate(oldsid, s.ID())
+	}
+}
+
+// rotateID moves the session to a fresh id and sends the new cookie, returning the old id.
+// returns false if no id could be generated
+func (s *Session) rotateID(w http.ResponseWriter) (string, bool) {
+	sid, err := s.newID()
+	if err != nil {
+		s.logf("session: generating session id: %v", err)
+		return "", false
+	}
+
+	oldsid := s.ID()
+	if enc, ok := s.provider.(CookieEncoder); ok {
+		// the session lives in the cookie, Commit sends it under its new id
+		s.store = enc.Rekey(s.store, sid)
+		s.id = sid
+	} else {
+		// providers move what they have stored, which misses the changes not saved yet
+		values := s.store.Snapshot()
+		old := s.store
+		s.store = s.providerRegenerate(s.id, sid)
+		s.id = sid
+		if s.store != old {
+			s.carryOver(values)
+		}
+		s.writeCookie(w, s.id, s.cookieMaxAge())
+	}
+
+	// Regenerate restarts the interval of Renew too
+	if s.store.Has(rotatedKey) {
+		s.store.Set(rotatedKey, time.Now().Unix())
+	}
+
+	return oldsid, true
+}
+
+// carryOver replaces the values of the store handed out by Regenerate with those the
+// session held under its old id and saves them right away, so that the new id never
+// serves the values last saved under the old one, e.g. the user of a logged out session
+func (s *Session) carryOver(values map[string]interface{}) {
+	stale := s.store.Keys()
+	s.store.Transaction(func(tx *Tx) error {
+		for _, key := range stale {
+			if _, ok := values[key]; !ok {
+				tx.Remove(key)
+			}
+		}
+		for key, data := range values {
+			tx.Set(key, data)
+		}
+		return nil
+	})
+
+	if err := s.providerSave(s.context()); err != nil {
+		s.logf("session: saving regenerated session: %v", err)
+	}
+}
+
+// Touch keeps the session alive without changing it, e.g. from a keepalive endpoint.
+// It records an access with the provider, see Toucher, and re-issues the cookie if Rolling is set.
+// Providers without Toucher only extend sessions when they are read, which Start already did
+func (s *Session) Touch(w http.ResponseWriter) {
+	if s.store == nil || s.destroyed || s.readOnly {
+		return
+	}
+
+	s.recordAccess(time.Now().Unix())
 
-		ck := cookie.AcquireCookie()
-		ck.Name = s.config.Key
-		ck.Value = s.id
-		ck.HttpOnly = true
-		ck.MaxAge = int(s.config.MaxAge)
+	if toucher, ok := s.provider.(Toucher); ok {
+		s.providerTouch(toucher)
+	}
+
+	if _, ok := s.provider.(CookieEncoder); s.config.Rolling && !ok {
+		s.writeCookie(w, s.id, s.cookieMaxAge())
+	}
+}
 
-		cookie.Add(ck, w)
-		cookie.ReleaseCookie(ck)
+// Expire marks the session as expired server-side and expires the session cookie,
+// so the next request starts over with a fresh session. Unlike Destroy the
+// session stays readable and writable for the rest of the current request, but
+// it is neither saved nor, with the cookie provider, committed anymore
+func (s *Session) Expire(w http.ResponseWriter) {
+	if s.store == nil || s.readOnly {
+		return
+	}
+
+	if expirer, ok := s.provider.(Expirer); ok {
+		s.providerExpire(expirer)
 	} else {
-		s.store = s.provider.Read(cookieValue, s.config.MaxAge)
+		s.providerDestroy(s.id)
+	}
+
+	s.expired = true
+	s.writeCookie(w, "", -1)
+}
+
+// writable reports whether the session may be modified, logging why if not.
+// panics for the Session returned by New, modifying it would silently lose the change
+func (s *Session) writable() bool {
+	if err := s.writeErr(); err != nil {
+		if !s.started {
+			panic("session: modifying the Session returned by New, call Start and modify the Session it returns")
+		}
+
+		s.logf("%v", err)
+		return false
+	}
+
+	return true
+}
+
+// writeErr returns why the session may not be modified, or nil
+func (s *Session) writeErr() error {
+	if s.readOnly {
+		return ErrSessionReadOnly
+	}
+	if s.destroyed {
+		return ErrSessionDestroyed
+	}
+	if s.store == nil {
+		return ErrSessionNotStarted
+	}
+
+	return nil
+}
+
+// Started reports whether s is the session of a request, returned by Start.
+// The Session returned by New is not started and holds no values: reads on it
+// miss, Transaction returns ErrSessionNotStarted and the other modifications panic
+func (s *Session) Started() bool {
+	return s.started
+}
+
+// readToken returns the session id carried by the request, see Config.TokenLookup,
+// or an empty string if there is none or its signature is invalid
+func (s *Session) readToken(req *http.Request) string {
+	sid, fromCookie := s.lookupToken(req)
+	s.cookieless = !fromCookie
+	return sid
+}
+
+// parseToken returns the session id carried by a token value, false if it is
+// malformed or its signature is invalid
+func (s *Session) parseToken(value string) (string, bool) {
+	if err := validateCookieValue(value); err != nil {
+		s.logf("%v", err)
+		return "", false
+	}
+
+	sid := value
+	if s.config.Signer != nil {
+		var ok bool
+		if sid, ok = unsignValue(s.config.Signer, value); !ok {
+			return "", false
+		}
+	}
+
+	if err := s.validateID(sid); err != nil {
+		s.logf("%v", err)
+		return "", false
+	}
+
+	return sid, true
+}
+
+// validateID checks that sid could have been generated by newID, so that clients can
+// not choose the id of the session created for them. Ids from a custom IDGenerator,
+// and the values of providers encoding the session in the cookie, are not checked
+func (s *Session) validateID(sid string) error {
+	if _, ok := s.provider.(CookieEncoder); ok || s.config.IDGenerator != nil {
+		return nil
+	}
+
+	if len(sid) != s.config.CookieLength {
+		return fmt.Errorf("%w: session id length %d, expected %d", ErrMalformedCookie, len(sid), s.config.CookieLength)
+	}
+
+	for i := 0; i < len(sid); i++ {
+		if strings.IndexByte(alphabet, sid[i]) < 0 {
+			return fmt.Errorf("%w: invalid session id byte %#x at offset %d", ErrMalformedCookie, sid[i], i)
+		}
+	}
+
+	return nil
+}
+
+// validateCookieValue checks that value is a reasonably sized
+// sequence of cookie-octets as defined by RFC 6265
+func validateCookieValue(value string) error {
+	if len(value) > maxCookieValueLength {
+		return fmt.Errorf("%w: length %d exceeds %d", ErrMalformedCookie, len(value), maxCookieValueLength)
+	}
+
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c <= ' ' || c >= 0x7f || c == '"' || c == ',' || c == ';' || c == '\\' {
+			return fmt.Errorf("%w: invalid byte %#x at offset %d", ErrMalformedCookie, c, i)
+		}
+	}
+
+	return nil
+}
+
+// validCookieName reports whether name is a token as defined by RFC 6265
+func validCookieName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c <= ' ' || c >= 0x7f || strings.IndexByte("()<>@,;:\\\"/[]?={}", c) >= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// logf writes an error message to the configured ErrorLog
+func (s *Session) logf(format string, args ...interface{}) {
+	if s.config.ErrorLog != nil {
+		s.config.ErrorLog.Printf(format, args...)
+		return
+	}
+
+	log.Printf(format, args...)
+}
+
+// writeCookie sends the session cookie holding sid. maxAge is the Max-Age in seconds,
+// 0 sends a session cookie and a negative value deletes the cookie
+func (s *Session) writeCookie(w http.ResponseWriter, sid string, maxAge int) {
+	if s.cookieless {
+		return
+	}
+
+	value := sid
+	if sid != "" && s.config.Signer != nil {
+		value = signValue(s.config.Signer, sid)
+	}
+
+	opts := CookieOptions{
+		Path:     s.config.Path,
+		Domain:   s.config.Domain,
+		MaxAge:   maxAge, // 0 omits Max-Age, a negative value sends Max-Age=0
+		Secure:   s.config.Secure,
+		HttpOnly: true,
+		SameSite: s.config.SameSite,
+	}
+
+	if opts.SameSite == http.SameSiteNoneMode && s.config.SameSiteCompat && sameSiteNoneIncompatible(s.userAgent) {
+		opts.SameSite = http.SameSiteDefaultMode
 	}
+
+	if s.config.CookieSetter != nil {
+		s.config.CookieSetter(w, opts.Cookie(s.config.Key, value))
+		return
+	}
+
+	s.cookieCodec().Write(s.config.Key, value, opts, w)
+}
+
+// cookieCodec returns the configured CookieCodec, StdCookieCodec if none
+func (s *Session) cookieCodec() CookieCodec {
+	if s.config.CookieCodec != nil {
+		return s.config.CookieCodec
+	}
+
+	return StdCookieCodec{}
 }
 
 func GetDriver(config *Config, req *http.Request, res http.ResponseWriter) *Session {
 	if ssn == nil {
-		New(config)
+		MustNew(config)
 	}
-	ssn.Start(res, req)
-	return ssn
+
+	return ssn.Start(res, req)
 }
 
 // RegisterProvider adds a provider to usable list.
 // panics if provider is already registered
 func RegisterProvider(providerName string, provider Provider) {
+	if err := RegisterProviderE(providerName, provider); err != nil {
+		panic(err)
+	}
+}
+
+// RegisterProviderE is like RegisterProvider but returns ErrProviderAlreadyRegistered
+// instead of panicking if provider is already registered
+func RegisterProviderE(providerName string, provider Provider) error {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
 	if _, ok := providers[providerName]; ok {
-		errStr := fmt.Sprintf("session: Provider %s is already registered", providerName)
-		panic(errStr)
+		return fmt.Errorf("%w: %q", ErrProviderAlreadyRegistered, providerName)
 	}
 
 	providers[providerName] = provider
+	return nil
+}
+
+// UnregisterProvider removes a provider from usable list.
+// Sessions already created with it keep using it. no-op if it is not registered
+func UnregisterProvider(providerName string) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	delete(providers, providerName)
+}
+
+// RegisteredProviders returns the sorted names of the registered providers
+func RegisteredProviders() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
 }
 
 // Get fetches an item from session store by key,
 // returns an empty interface and false if it doesnt exist
 func (s *Session) Get(key string) (interface{}, bool) {
-	return s.store.Get(key)
+	if s.store == nil {
+		return nil, false
+	}
+
+	data, ok := s.store.Get(key)
+	if ok && s.expireKey(key) {
+		return nil, false
+	}
+
+	if c, isComputed := data.(*computedValue); isComputed {
+		return c.get(), ok
+	}
+
+	return data, ok
 }
 
-// GetString returns a string item from session store
-func (s *Session) GetString(key string) (string, bool) {
+// GetAs returns an item of type T from session store,
+// returns the zero value of T and false if it doesnt exist or has another type
+func GetAs[T any](s *Session, key string) (T, bool) {
 	data, ok := s.Get(key)
 	if !ok {
-		return "", false
+		var zero T
+		return zero, false
 	}
 
-	str, ok := data.(string)
-	return str, ok
+	v, ok := data.(T)
+	return v, ok
+}
+
+// GetString returns a string item from session store
+func (s *Session) GetString(key string) (string, bool) {
+	return GetAs[string](s, key)
 }
 
 // GetInt returns an integer item from session store
 func (s *Session) GetInt(key string) (int, bool) {
+	return GetAs[int](s, key)
+}
+
+// GetBool returns a boolean item from session store
+func (s *Session) GetBool(key string) (bool, bool) {
+	return GetAs[bool](s, key)
+}
+
+// GetFloat64 returns a float64 item from session store
+func (s *Session) GetFloat64(key string) (float64, bool) {
+	return GetAs[float64](s, key)
+}
+
+// GetBytes returns a byte slice item from session store
+func (s *Session) GetBytes(key string) ([]byte, bool) {
+	return GetAs[[]byte](s, key)
+}
+
+// GetTime returns a time item from session store
+func (s *Session) GetTime(key string) (time.Time, bool) {
+	return GetAs[time.Time](s, key)
+}
+
+// GetStringSlice returns a string slice item from session store
+func (s *Session) GetStringSlice(key string) ([]string, bool) {
+	return GetAs[[]string](s, key)
+}
+
+// GetAsE is like GetAs but tells the reasons for a miss apart, returning ErrNotStarted,
+// ErrKeyNotFound or ErrTypeMismatch, which can be tested with errors.Is
+func GetAsE[T any](s *Session, key string) (T, error) {
+	var zero T
+	if s.store == nil {
+		return zero, ErrNotStarted
+	}
+
 	data, ok := s.Get(key)
 	if !ok {
-		return 0, false
+		return zero, fmt.Errorf("%w: %q", ErrKeyNotFound, key)
 	}
 
-	i, ok := data.(int)
-	return i, ok
+	v, ok := data.(T)
+	if !ok {
+		return zero, fmt.Errorf("%w: %q holds %T, not %T", ErrTypeMismatch, key, data, zero)
+	}
+
+	return v, nil
+}
+
+// GetStringE returns a string item from session store, see GetAsE for the errors
+func (s *Session) GetStringE(key string) (string, error) {
+	return GetAsE[string](s, key)
+}
+
+// GetIntE returns an integer item from session store, see GetAsE for the errors
+func (s *Session) GetIntE(key string) (int, error) {
+	return GetAsE[int](s, key)
+}
+
+// GetBoolE returns a boolean item from session store, see GetAsE for the errors
+func (s *Session) GetBoolE(key string) (bool, error) {
+	return GetAsE[bool](s, key)
+}
+
+// GetFloat64E returns a float64 item from session store, see GetAsE for the errors
+func (s *Session) GetFloat64E(key string) (float64, error) {
+	return GetAsE[float64](s, key)
+}
+
+// GetBytesE returns a byte slice item from session store, see GetAsE for the errors
+func (s *Session) GetBytesE(key string) ([]byte, error) {
+	return GetAsE[[]byte](s, key)
+}
+
+// GetTimeE returns a time item from session store, see GetAsE for the errors
+func (s *Session) GetTimeE(key string) (time.Time, error) {
+	return GetAsE[time.Time](s, key)
+}
+
+// GetStringSliceE returns a string slice item from session store, see GetAsE for the errors
+func (s *Session) GetStringSliceE(key string) ([]string, error) {
+	return GetAsE[[]string](s, key)
 }
 
-// Set adds an item to session store, identified by provided key
+// Set adds an item to session store, identified by provided key.
+// With providers serializing sessions, the type of data must be registered with RegisterType
+// unless it is a basic type
 func (s *Session) Set(key string, data interface{}) {
-	s.store.Set(key, data)
+	if !s.writable() {
+		return
+	}
+
+	if !s.hasTTL(key) {
+		s.store.Set(key, data)
+		return
+	}
+
+	s.store.Transaction(func(tx *Tx) error {
+		tx.Set(key, data)
+		clearExpiries(tx, key)
+		return nil
+	})
+}
+
+// SetMany adds all values to session store at once,
+// e.g. to populate the session after login
+func (s *Session) SetMany(values map[string]interface{}) {
+	if !s.writable() {
+		return
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+
+	if !s.hasTTL(keys...) {
+		s.store.SetMany(values)
+		return
+	}
+
+	s.store.Transaction(func(tx *Tx) error {
+		for key, data := range values {
+			tx.Set(key, data)
+		}
+		clearExpiries(tx, keys...)
+		return nil
+	})
+}
+
+// GetOrSet returns the item saved under key, or computes it with fn, saves it and returns it
+// if there is none, e.g. to lazily create a per-session resource. Concurrent calls for the
+// same key run fn once and all get its result. fn runs under the store lock, so it must be
+// cheap and must not use the session. Sessions that can not be modified only return the
+// existing item, without calling fn
+func (s *Session) GetOrSet(key string, fn func() interface{}) interface{} {
+	if !s.writable() {
+		data, _ := s.Get(key)
+		return data
+	}
+
+	s.expireKey(key)
+
+	data := s.store.GetOrSet(key, fn)
+	if c, isComputed := data.(*computedValue); isComputed {
+		return c.get()
+	}
+
+	return data
+}
+
+// RotateValue atomically replaces the item stored under key with the value returned by generate,
+// which receives the current item (nil if missing). returns the new value
+func (s *Session) RotateValue(key string, generate func(old interface{}) interface{}) interface{} {
+	if !s.writable() {
+		return nil
+	}
+
+	return s.store.Modify(key, func(data interface{}, ok bool) interface{} {
+		return generate(data)
+	})
 }
 
 // Remove deletes an item from session store by provided key
 func (s *Session) Remove(key string) {
-	s.store.Remove(key)
+	if !s.writable() {
+		return
+	}
+
+	if !s.hasTTL(key) {
+		s.store.Remove(key)
+		return
+	}
+
+	s.store.Transaction(func(tx *Tx) error {
+		tx.Remove(key)
+		clearExpiries(tx, key)
+		return nil
+	})
 }
 
 // Pull gets an item from session store and deletes the item from session
 func (s *Session) Pull(key string) (interface{}, bool) {
-	data, ok := s.store.Get(key)
+	data, ok := s.Get(key)
 	s.Remove(key)
 
 	return data, ok
@@ -172,12 +1384,169 @@ func (s *Session) PullInt(key string) (int, bool) {
 	return data, ok
 }
 
-// Clear empties the session store
+// PullBool gets a boolean item from session store and deletes the item from session
+func (s *Session) PullBool(key string) (bool, bool) {
+	data, ok := s.GetBool(key)
+	s.Remove(key)
+
+	return data, ok
+}
+
+// PullFloat64 gets a float64 item from session store and deletes the item from session
+func (s *Session) PullFloat64(key string) (float64, bool) {
+	data, ok := s.GetFloat64(key)
+	s.Remove(key)
+
+	return data, ok
+}
+
+// PullBytes gets a byte slice item from session store and deletes the item from session
+func (s *Session) PullBytes(key string) ([]byte, bool) {
+	data, ok := s.GetBytes(key)
+	s.Remove(key)
+
+	return data, ok
+}
+
+// Has reports whether an item is saved in session store under key
+func (s *Session) Has(key string) bool {
+	if s.store == nil {
+		return false
+	}
+
+	return s.store.Has(key) && !s.expireKey(key)
+}
+
+// Keys returns the keys of the items in session store,
+// leaving out the keys the package reserves for its own state
+func (s *Session) Keys() []string {
+	if s.store == nil {
+		return nil
+	}
+
+	now := time.Now().UnixNano()
+	keys := s.store.Keys()
+	visible := keys[:0]
+	for _, key := range keys {
+		if !strings.HasPrefix(key, reservedPrefix) && !s.keyExpired(key, now) {
+			visible = append(visible, key)
+		}
+	}
+
+	return visible
+}
+
+// Len returns the number of items in session store, as listed by Keys
+func (s *Session) Len() int {
+	return len(s.Keys())
+}
+
+// PullTime gets a time item from session store and deletes the item from session
+func (s *Session) PullTime(key string) (time.Time, bool) {
+	data, ok := s.GetTime(key)
+	s.Remove(key)
+
+	return data, ok
+}
+
+// PullStringSlice gets a string slice item from session store and deletes the item from session
+func (s *Session) PullStringSlice(key string) ([]string, bool) {
+	data, ok := s.GetStringSlice(key)
+	s.Remove(key)
+
+	return data, ok
+}
+
+// Snapshot returns a shallow copy of the items in session store, reserved ones included,
+// that can be iterated without racing concurrent writes or restored with SetMany.
+// Computed items hold their current value and items past their TTL are left out
+func (s *Session) Snapshot() map[string]interface{} {
+	if s.store == nil {
+		return nil
+	}
+
+	values := s.store.Snapshot()
+	expiries, _ := values[ttlKey].(map[string]int64)
+	now := time.Now().UnixNano()
+
+	for key, data := range values {
+		if expiresAt, ok := expiries[key]; ok && expiresAt <= now {
+			delete(values, key)
+			continue
+		}
+
+		if c, isComputed := data.(*computedValue); isComputed {
+			values[key] = c.get()
+		}
+	}
+
+	return values
+}
+
+// Size returns the approximate serialized size of the session in bytes
+func (s *Session) Size() int {
+	if s.store == nil {
+		return 0
+	}
+
+	return s.store.Size()
+}
+
+// Clear removes every item from session store, as listed by Keys. The reserved items
+// holding the state of the package, e.g. the client bindings and the creation time
+// AbsoluteTimeout counts from, are kept
 func (s *Session) Clear() {
-	s.store.Clear()
+	if !s.writable() {
+		return
+	}
+
+	s.clearExcept(nil)
+}
+
+// clearExcept removes every item but the kept keys and the reserved ones, along with
+// their TTLs, so that the bindings, timeouts and TTLs of kept items carry on
+func (s *Session) clearExcept(kept map[string]bool) {
+	var keys []string
+	for _, key := range s.store.Keys() {
+		if !strings.HasPrefix(key, reservedPrefix) && !kept[key] {
+			keys = append(keys, key)
+		}
+	}
+
+	s.store.Transaction(func(tx *Tx) error {
+		for _, key := range keys {
+			tx.Remove(key)
+		}
+		clearExpiries(tx, keys...)
+		return nil
+	})
+}
+
+// CreatedAt returns when the session was created, the zero time if it was not started.
+// see Store.CreatedAt for the accuracy per provider
+func (s *Session) CreatedAt() time.Time {
+	if s.store == nil {
+		return time.Time{}
+	}
+
+	return s.store.CreatedAt()
+}
+
+// LastAccessed returns when the session was last read or touched, the zero time if it
+// was not started, e.g. to warn users of an upcoming idle logout
+func (s *Session) LastAccessed() time.Time {
+	if s.store == nil {
+		return time.Time{}
+	}
+
+	return s.store.LastAccessed()
 }
 
 // ID returns the session id
 func (s *Session) ID() string {
+	if s.store != nil {
+		return s.store.ID()
+	}
+
 	return s.id
 }
@@ -0,0 +1,664 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// newTestManager returns the Session of a configuration using provider, a fresh memory
+// provider if nil. configure, when not nil, adjusts the configuration before New
+func newTestManager(t *testing.T, provider Provider, configure func(cfg *Config)) *Session {
+	t.Helper()
+
+	if provider == nil {
+		provider = NewMemoryProvider()
+	}
+
+	cfg := &Config{
+		Key:              "sid",
+		MaxAge:           3600,
+		ProviderInstance: provider,
+		ErrorLog:         log.New(io.Discard, "", 0),
+	}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	m, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	return m
+}
+
+// startRequest starts the session of a request sending cookies
+func startRequest(m *Session, cookies ...*http.Cookie) (*Session, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+
+	w := httptest.NewRecorder()
+	return m.Start(w, req), w
+}
+
+// responseCookie returns the last cookie named name set on w, nil if there is none
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	var found *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == name {
+			found = c
+		}
+	}
+
+	return found
+}
+
+// testRegenerateReload checks that changes made before Regenerate are stored under the
+// new id. newProvider must return providers sharing a single backend, so that a second
+// one reads what the first stored as a restarted process would
+func testRegenerateReload(t *testing.T, newProvider func() Provider) {
+	t.Run("set", func(t *testing.T) {
+		rs, _ := startRequest(newTestManager(t, newProvider(), nil))
+		oldsid := rs.ID()
+
+		rs.Set("user_id", 42)
+		rs.Regenerate(httptest.NewRecorder())
+
+		reloaded := newProvider()
+		if reloaded.Exists(oldsid) {
+			t.Errorf("old id %q still exists", oldsid)
+		}
+
+		store := reloaded.Read(rs.ID(), 3600)
+		if data, _ := store.Get("user_id"); data != 42 {
+			t.Errorf("user_id = %v after reload, want 42", data)
+		}
+	})
+
+	t.Run("deauthenticate", func(t *testing.T) {
+		rs, _ := startRequest(newTestManager(t, newProvider(), nil))
+		rs.SetMany(map[string]interface{}{"user_id": 42, "cart": "book"})
+		if err := rs.Save(); err != nil {
+			t.Fatalf("Save: %v", err)
+		}
+
+		rs.DeauthenticateKeeping(httptest.NewRecorder(), "cart")
+
+		store := newProvider().Read(rs.ID(), 3600)
+		if data, ok := store.Get("user_id"); ok {
+			t.Errorf("user_id = %v after reload, want it removed", data)
+		}
+		if data, _ := store.Get("cart"); data != "book" {
+			t.Errorf("cart = %v after reload, want book", data)
+		}
+	})
+}
+
+// testSaveAfterDestroy checks that saving a store after its session was destroyed,
+// as a request racing another one's logout does, does not bring the session back
+func testSaveAfterDestroy(t *testing.T, p Provider) {
+	t.Helper()
+
+	store := p.Initialize("sid1", 3600)
+	store.Set("user_id", 42)
+	if err := p.Save(store); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	p.Destroy("sid1")
+	store.Set("cart", "book")
+	if err := p.Save(store); err != nil {
+		t.Errorf("Save after Destroy: %v", err)
+	}
+
+	if p.Exists("sid1") {
+		t.Error("saving after Destroy recreated the session")
+	}
+}
+
+func TestStartResumesKnownID(t *testing.T) {
+	m := newTestManager(t, nil, nil)
+	first, w := startRequest(m)
+	first.Set("user_id", 42)
+
+	rs, _ := startRequest(m, responseCookie(w, "sid"))
+	if rs.ID() != first.ID() {
+		t.Fatalf("id = %q, want the id of the cookie %q", rs.ID(), first.ID())
+	}
+	if data, _ := rs.Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v, want 42", data)
+	}
+}
+
+// resumeRecorder is a memory provider recording the ids it is asked about
+type resumeRecorder struct {
+	*MemorySessionProvider
+	asked []string
+}
+
+func (r *resumeRecorder) Exists(sid string) bool {
+	r.asked = append(r.asked, sid)
+	return r.MemorySessionProvider.Exists(sid)
+}
+
+func (r *resumeRecorder) Read(sid string, maxAge int64) Store {
+	r.asked = append(r.asked, sid)
+	return r.MemorySessionProvider.Read(sid, maxAge)
+}
+
+func TestStartRejectsForgedID(t *testing.T) {
+	for name, tc := range map[string]struct {
+		forged string
+		// wellFormed ids are checked with the provider, malformed ones must be
+		// refused without asking it
+		wellFormed bool
+	}{
+		"empty":        {forged: ""},
+		"too short":    {forged: strings.Repeat("A", 31)},
+		"too long":     {forged: strings.Repeat("A", 33)},
+		"non-alphabet": {forged: strings.Repeat("A", 31) + "-"},
+		"base64":       {forged: strings.Repeat("A", 30) + "+/"},
+		"unknown":      {forged: strings.Repeat("A", 32), wellFormed: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			provider := &resumeRecorder{MemorySessionProvider: NewMemoryProvider()}
+			m := newTestManager(t, provider, nil)
+
+			rs, w := startRequest(m, &http.Cookie{Name: "sid", Value: tc.forged})
+			if rs.ID() == tc.forged || len(rs.ID()) != 32 {
+				t.Fatalf("session id %q, want a new one instead of %q", rs.ID(), tc.forged)
+			}
+			if c := responseCookie(w, "sid"); c == nil || c.Value != rs.ID() {
+				t.Errorf("cookie = %v, want the new id %q", c, rs.ID())
+			}
+			if provider.MemorySessionProvider.Exists(tc.forged) {
+				t.Error("a session was created under the forged id")
+			}
+
+			for _, sid := range provider.asked {
+				if sid == tc.forged && !tc.wellFormed {
+					t.Errorf("the provider was asked to resume %q", tc.forged)
+				}
+			}
+		})
+	}
+}
+
+func TestStartTwiceReturnsTheSession(t *testing.T) {
+	m := newTestManager(t, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	w := httptest.NewRecorder()
+
+	first := m.Start(w, req)
+	first.Set("user_id", 42)
+	second := m.Start(w, req)
+
+	if second != first || second.ID() != first.ID() {
+		t.Fatalf("second Start returned session %q, want %q", second.ID(), first.ID())
+	}
+	if data, _ := second.Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v, want 42", data)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 {
+		t.Errorf("%d cookies sent, want 1", len(cookies))
+	}
+}
+
+func TestStartInHandlerReturnsTheMiddlewareSession(t *testing.T) {
+	m := newTestManager(t, nil, nil)
+
+	var outer, inner *Session
+	handler := m.Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		outer, _ = FromContext(req.Context())
+		inner = m.Start(w, req)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if inner == nil || inner != outer {
+		t.Fatalf("Start in the handler returned %v, want the middleware session %v", inner, outer)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 {
+		t.Errorf("%d cookies sent, want 1", len(cookies))
+	}
+}
+
+func TestStartIsolatesConcurrentRequests(t *testing.T) {
+	m := newTestManager(t, nil, nil)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rs, w := startRequest(m)
+			rs.Set("n", i)
+
+			again, _ := startRequest(m, responseCookie(w, "sid"))
+			if data, _ := again.Get("n"); data != i {
+				t.Errorf("request %d read n = %v", i, data)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestManagerModificationPanics(t *testing.T) {
+	m := newTestManager(t, nil, nil)
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Set on the manager did not panic")
+		}
+	}()
+	m.Set("user_id", 42)
+}
+
+func TestClearKeepsReservedItems(t *testing.T) {
+	m := newTestManager(t, nil, func(cfg *Config) {
+		cfg.Fingerprint = ClientFingerprint
+		cfg.AbsoluteTimeout = time.Hour
+	})
+
+	rs, w := startRequest(m)
+	rs.Set("user_id", 42)
+	rs.SetWithTTL("otp", "123456", time.Minute)
+	created, _ := rs.store.Get(createdKey)
+
+	rs.Clear()
+	if keys := rs.Keys(); len(keys) != 0 {
+		t.Errorf("Keys = %v after Clear, want none", keys)
+	}
+	if data, _ := rs.store.Get(createdKey); data != created {
+		t.Errorf("creation time = %v after Clear, want %v", data, created)
+	}
+	if !rs.store.Has(fingerprintKey) {
+		t.Fatal("the fingerprint was cleared")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("User-Agent", "another client")
+	req.AddCookie(responseCookie(w, "sid"))
+	if other := m.Start(httptest.NewRecorder(), req); other.ID() == rs.ID() {
+		t.Error("another client was handed the cleared session")
+	}
+}
+
+func TestDeauthenticateKeepingLeavesKeysUntouched(t *testing.T) {
+	rs, _ := startRequest(newTestManager(t, nil, nil))
+	rs.SetMany(map[string]interface{}{"user_id": 42, "cart": "book", "locale": "fr"})
+
+	backing := []string{"cart", "locale", "spare"}
+	keys := backing[:1]
+	rs.DeauthenticateKeeping(httptest.NewRecorder(), keys...)
+
+	if backing[1] != "locale" || backing[2] != "spare" {
+		t.Errorf("DeauthenticateKeeping wrote into the caller's slice: %v", backing)
+	}
+	if rs.Has("user_id") || rs.Has("locale") {
+		t.Errorf("Keys = %v, want only cart", rs.Keys())
+	}
+	if data, _ := rs.Get("cart"); data != "book" {
+		t.Errorf("cart = %v, want book", data)
+	}
+}
+
+func TestDeauthenticateKeeping(t *testing.T) {
+	p := NewMemoryProvider()
+	m := newTestManager(t, p, func(cfg *Config) { cfg.AbsoluteTimeout = time.Hour })
+
+	rs, _ := startRequest(m)
+	rs.SetMany(map[string]interface{}{"user_id": 42, "cart": "book"})
+	rs.SetWithTTL("coupon", "SPRING", time.Minute)
+	rs.SetWithTTL("otp", "123456", time.Minute)
+	rs.store.Set(createdKey, time.Now().Add(-2*time.Hour).Unix())
+	oldsid := rs.ID()
+
+	w := httptest.NewRecorder()
+	rs.DeauthenticateKeeping(w, "cart", "coupon")
+
+	if rs.ID() == oldsid || p.Exists(oldsid) {
+		t.Error("the session id was not rotated")
+	}
+	if c := responseCookie(w, "sid"); c == nil || c.Value != rs.ID() {
+		t.Fatalf("cookie = %v, want one carrying the new id", c)
+	}
+	if rs.Has("user_id") || rs.Has("otp") {
+		t.Errorf("Keys = %v, want only cart and coupon", rs.Keys())
+	}
+	if !rs.hasTTL("coupon") || rs.hasTTL("otp") {
+		t.Error("the TTL of the kept coupon was not carried over alone")
+	}
+
+	if next, _ := startRequest(m, responseCookie(w, "sid")); next.ID() == rs.ID() {
+		t.Error("the absolute timeout started over")
+	}
+}
+
+func TestValidateCookieValue(t *testing.T) {
+	for value, valid := range map[string]bool{
+		strings.Repeat("a", 32):                     true,
+		"abc-_.~!#$%&'()*+/:<=>?@[]^`{|}":           true,
+		strings.Repeat("a", maxCookieValueLength):   true,
+		strings.Repeat("a", maxCookieValueLength+1): false,
+		"abc def":                false,
+		"abc\x00def":             false,
+		"abc\r\nSet-Cookie: x=y": false,
+		"abc\x7f":                false,
+		"caf\xc3\xa9":            false,
+		`"quoted"`:               false,
+		"a,b":                    false,
+		"a;b":                    false,
+		"a\\b":                   false,
+	} {
+		err := validateCookieValue(value)
+		if valid && err != nil {
+			t.Errorf("validateCookieValue(%.40q) = %v, want nil", value, err)
+		}
+		if !valid && !errors.Is(err, ErrMalformedCookie) {
+			t.Errorf("validateCookieValue(%.40q) = %v, want ErrMalformedCookie", value, err)
+		}
+	}
+}
+
+func TestStartIgnoresMalformedCookies(t *testing.T) {
+	var logged strings.Builder
+	m := newTestManager(t, nil, func(cfg *Config) { cfg.ErrorLog = log.New(&logged, "", 0) })
+	first, w := startRequest(m)
+	first.Set("user_id", 42)
+	sid := responseCookie(w, "sid").Value
+
+	// net/http already drops cookies with control characters, only oversized ones are logged
+	for name, tc := range map[string]struct {
+		value  string
+		logged bool
+	}{
+		"oversized": {sid + strings.Repeat("a", maxCookieValueLength), true},
+		"control":   {sid + "\x01", false},
+	} {
+		logged.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Cookie", "sid="+tc.value)
+
+		rs := m.Start(httptest.NewRecorder(), req)
+		if rs.ID() == first.ID() || rs.Has("user_id") {
+			t.Errorf("%s: the malformed cookie resumed the session", name)
+		}
+		if tc.logged && !strings.Contains(logged.String(), ErrMalformedCookie.Error()) {
+			t.Errorf("%s: logged %q, want the malformed cookie reported", name, logged.String())
+		}
+	}
+}
+
+func TestRotateValueConcurrent(t *testing.T) {
+	rs, _ := startRequest(newTestManager(t, nil, nil))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			rs.RotateValue("counter", func(old interface{}) interface{} {
+				n, _ := old.(int)
+				return n + 1
+			})
+		}()
+	}
+	wg.Wait()
+
+	if data, _ := rs.Get("counter"); data != 50 {
+		t.Errorf("counter = %v after 50 rotations, want 50", data)
+	}
+
+	var seen interface{}
+	next := rs.RotateValue("counter", func(old interface{}) interface{} {
+		seen = old
+		return "reset"
+	})
+	if seen != 50 || next != "reset" {
+		t.Errorf("RotateValue saw %v and returned %v, want 50 and reset", seen, next)
+	}
+}
+
+func TestOperationsAfterDestroy(t *testing.T) {
+	destroyed := 0
+	provider := NewMemoryProvider()
+	m := newTestManager(t, provider, func(cfg *Config) {
+		cfg.OnDestroy = func(string) { destroyed++ }
+	})
+
+	rs, _ := startRequest(m)
+	rs.Set("user_id", 42)
+	sid := rs.ID()
+
+	w := httptest.NewRecorder()
+	rs.Destroy(w)
+	if c := responseCookie(w, "sid"); c == nil || c.MaxAge >= 0 {
+		t.Errorf("cookie = %v, want the session cookie deleted", c)
+	}
+	if provider.Exists(sid) {
+		t.Error("the provider still holds the destroyed session")
+	}
+
+	rs.Set("user_id", 7)
+	rs.SetMany(map[string]interface{}{"cart": "book"})
+	rs.SetWithTTL("otp", "123456", time.Minute)
+	rs.Flash("notice", "bye")
+	rs.Remove("user_id")
+	rs.Pull("user_id")
+	rs.Clear()
+	rs.GetOrSet("cart", func() interface{} { return "book" })
+	rs.RotateValue("counter", func(interface{}) interface{} { return 1 })
+	rs.RememberIdempotencyKey("order-1", time.Hour)
+	rs.Regenerate(httptest.NewRecorder())
+	rs.Touch(httptest.NewRecorder())
+	rs.Destroy(httptest.NewRecorder())
+
+	if err := rs.Transaction(func(tx *Tx) error { tx.Set("user_id", 7); return nil }); !errors.Is(err, ErrSessionDestroyed) {
+		t.Errorf("Transaction = %v, want ErrSessionDestroyed", err)
+	}
+	if err := rs.Save(); err != nil {
+		t.Errorf("Save = %v, want nil", err)
+	}
+	if _, ok := rs.Get("user_id"); ok || rs.Has("cart") || rs.Len() != 0 || len(rs.Keys()) != 0 {
+		t.Errorf("the destroyed session holds %v", rs.Snapshot())
+	}
+	if n := provider.Count(); n != 0 {
+		t.Errorf("the provider holds %d sessions, an operation after Destroy recreated one", n)
+	}
+	if destroyed != 1 {
+		t.Errorf("OnDestroy called %d times, want 1", destroyed)
+	}
+
+	m.Destroy(httptest.NewRecorder())
+}
+
+func TestMaxAgeRounding(t *testing.T) {
+	for _, tc := range []struct {
+		maxAge   int64
+		rounding time.Duration
+		want     int
+	}{
+		{5000, time.Hour, 3600},
+		{6000, time.Hour, 7200},
+		{600, time.Hour, 3600},
+		{5000, 0, 5000},
+	} {
+		provider := NewMemoryProvider()
+		m := newTestManager(t, provider, func(cfg *Config) {
+			cfg.MaxAge = tc.maxAge
+			cfg.MaxAgeRounding = tc.rounding
+		})
+
+		before := time.Now().Unix()
+		rs, w := startRequest(m)
+		if c := responseCookie(w, "sid"); c == nil || c.MaxAge != tc.want {
+			t.Errorf("MaxAge %d rounded to %v: cookie = %v, want Max-Age %d", tc.maxAge, tc.rounding, c, tc.want)
+		}
+
+		store := provider.Read(rs.ID(), tc.maxAge).(*MemorySessionStore)
+		store.RLock()
+		expiresAt := store.expresAt
+		store.RUnlock()
+		if expiresAt < before+tc.maxAge || expiresAt > time.Now().Unix()+tc.maxAge {
+			t.Errorf("MaxAge %d: the server expires the session in %d seconds, want exactly %d", tc.maxAge, expiresAt-before, tc.maxAge)
+		}
+	}
+}
+
+func TestCookieSetter(t *testing.T) {
+	var set []*http.Cookie
+	m := newTestManager(t, nil, func(cfg *Config) {
+		cfg.Path = "/app"
+		cfg.CookieSetter = func(w http.ResponseWriter, c *http.Cookie) { set = append(set, c) }
+	})
+
+	rs, w := startRequest(m)
+	if len(w.Result().Cookies()) != 0 {
+		t.Error("the default cookie writing was used")
+	}
+	if len(set) != 1 {
+		t.Fatalf("CookieSetter called %d times, want 1", len(set))
+	}
+	if c := set[0]; c.Name != "sid" || c.Value != rs.ID() || c.Path != "/app" || !c.HttpOnly || c.MaxAge != 3600 {
+		t.Errorf("CookieSetter received %v, want the session cookie", c)
+	}
+
+	rs.Destroy(w)
+	if len(set) != 2 || set[1].MaxAge >= 0 {
+		t.Errorf("CookieSetter received %v on Destroy, want the deleting cookie", set[len(set)-1])
+	}
+}
+
+func TestStartOnStartedSessionIsANoop(t *testing.T) {
+	starts := 0
+	m := newTestManager(t, nil, func(cfg *Config) { cfg.OnStart = func(string) { starts++ } })
+
+	rs, w := startRequest(m)
+	rs.Set("user_id", 42)
+
+	again, err := rs.StartE(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil || again != rs {
+		t.Fatalf("StartE on the started session = %v, %v, want the session itself", again, err)
+	}
+	if data, _ := again.Get("user_id"); data != 42 || again.ID() != rs.ID() {
+		t.Errorf("the second Start changed the session: id %q, user_id %v", again.ID(), data)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 {
+		t.Errorf("%d cookies sent, want 1", len(cookies))
+	}
+	if starts != 1 {
+		t.Errorf("OnStart called %d times, want 1", starts)
+	}
+}
+
+func TestStartSurfacesIDGeneratorErrors(t *testing.T) {
+	for name, generate := range map[string]func() (string, error){
+		"error": func() (string, error) { return "", errors.New("no entropy") },
+		"empty": func() (string, error) { return "", nil },
+	} {
+		provider := NewMemoryProvider()
+		m := newTestManager(t, provider, func(cfg *Config) { cfg.IDGenerator = generate })
+
+		w := httptest.NewRecorder()
+		rs, err := m.StartE(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if err == nil {
+			t.Errorf("%s: StartE succeeded", name)
+		}
+		if rs == nil || rs.ID() != "" {
+			t.Fatalf("%s: StartE returned %v, want a session without id", name, rs)
+		}
+		if c := responseCookie(w, "sid"); c != nil {
+			t.Errorf("%s: cookie %v sent", name, c)
+		}
+		if provider.Count() != 0 {
+			t.Errorf("%s: a session was created", name)
+		}
+
+		rs.Set("user_id", 42)
+		if other, _ := startRequest(m); other.Has("user_id") {
+			t.Errorf("%s: the throwaway session was shared with another request", name)
+		}
+	}
+}
+
+func TestStartSurfacesRandReaderErrors(t *testing.T) {
+	withRandReader(t, iotest.ErrReader(errors.New("no entropy")))
+	m := newTestManager(t, nil, nil)
+
+	w := httptest.NewRecorder()
+	if rs, err := m.StartE(w, httptest.NewRequest(http.MethodGet, "/", nil)); err == nil || rs.ID() != "" {
+		t.Errorf("StartE = %q, %v, want the read error and no id", rs.ID(), err)
+	}
+	if c := responseCookie(w, "sid"); c != nil {
+		t.Errorf("cookie %v sent", c)
+	}
+}
+
+func TestProviderRegistryConcurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		name := "concurrent-" + strconv.Itoa(i)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				if err := RegisterProviderE(name, NewMemoryProvider()); err != nil {
+					t.Errorf("RegisterProviderE(%q): %v", name, err)
+					return
+				}
+				if err := RegisterProviderE(name, NewMemoryProvider()); !errors.Is(err, ErrProviderAlreadyRegistered) {
+					t.Errorf("registering %q twice = %v, want ErrProviderAlreadyRegistered", name, err)
+				}
+				UnregisterProvider(name)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+
+			for j := 0; j < 50; j++ {
+				RegisteredProviders()
+				New(&Config{Key: "sid", Provider: name, ErrorLog: log.New(io.Discard, "", 0)})
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, name := range RegisteredProviders() {
+		if strings.HasPrefix(name, "concurrent-") {
+			t.Errorf("%q is still registered", name)
+		}
+	}
+}
+
+func TestClearKeepsAbsoluteTimeout(t *testing.T) {
+	m := newTestManager(t, nil, func(cfg *Config) { cfg.AbsoluteTimeout = time.Hour })
+
+	rs, w := startRequest(m)
+	rs.Set("user_id", 42)
+	rs.store.Set(createdKey, time.Now().Add(-2*time.Hour).Unix())
+	rs.Clear()
+
+	if next, _ := startRequest(m, responseCookie(w, "sid")); next.ID() == rs.ID() {
+		t.Error("the cleared session outlived AbsoluteTimeout")
+	}
+}
@@ -0,0 +1,67 @@
+package session
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+)
+
+type (
+	// Signer represents a scheme used to sign and verify session cookie values
+	Signer interface {
+		// Sign returns the signature of data
+		Sign(data []byte) []byte
+		// Verify reports whether sig is a valid signature of data
+		Verify(data, sig []byte) bool
+	}
+
+	// HMACSigner signs data with HMAC-SHA256
+	HMACSigner struct {
+		key []byte
+	}
+)
+
+// NewHMACSigner returns a HMAC-SHA256 signer using the provided secret key
+func NewHMACSigner(key []byte) *HMACSigner {
+	return &HMACSigner{key: key}
+}
+
+// Sign returns the HMAC-SHA256 of data
+func (h *HMACSigner) Sign(data []byte) []byte {
+	mac := hmac.New(sha256.New, h.key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// Verify checks sig against the HMAC-SHA256 of data in constant time
+func (h *HMACSigner) Verify(data, sig []byte) bool {
+	return hmac.Equal(h.Sign(data), sig)
+}
+
+// signValue appends the encoded signature of value, separated by a dot
+func signValue(signer Signer, value string) string {
+	sig := signer.Sign([]byte(value))
+	return value + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// unsignValue verifies a value produced by signValue and returns the original value.
+// returns false if the value is not signed or the signature does not match
+func unsignValue(signer Signer, signed string) (string, bool) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", false
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(signed[i+1:])
+	if err != nil {
+		return "", false
+	}
+
+	value := signed[:i]
+	if !signer.Verify([]byte(value), sig) {
+		return "", false
+	}
+
+	return value, true
+}
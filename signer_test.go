@@ -0,0 +1,63 @@
+package session
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// reverseSigner is a custom Signer whose signature is the reversed data
+type reverseSigner struct{}
+
+func (reverseSigner) Sign(data []byte) []byte {
+	sig := make([]byte, len(data))
+	for i, b := range data {
+		sig[len(data)-1-i] = b
+	}
+
+	return sig
+}
+
+func (s reverseSigner) Verify(data, sig []byte) bool {
+	return bytes.Equal(s.Sign(data), sig)
+}
+
+func TestCustomSignerRoundTrip(t *testing.T) {
+	m := newTestManager(t, nil, func(cfg *Config) { cfg.Signer = reverseSigner{} })
+	first, w := startRequest(m)
+	first.Set("user_id", 42)
+
+	cookie := responseCookie(w, "sid")
+	if cookie == nil || cookie.Value != signValue(reverseSigner{}, first.ID()) {
+		t.Fatalf("cookie = %v, want the id signed by the custom signer", cookie)
+	}
+
+	rs, _ := startRequest(m, cookie)
+	if rs.ID() != first.ID() {
+		t.Fatalf("id = %q, want %q", rs.ID(), first.ID())
+	}
+	if data, _ := rs.Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v, want 42", data)
+	}
+}
+
+func TestSignerRejectsTamperedCookies(t *testing.T) {
+	m := newTestManager(t, nil, func(cfg *Config) { cfg.Signer = NewHMACSigner([]byte("secret")) })
+	first, w := startRequest(m)
+	first.Set("user_id", 42)
+	value := responseCookie(w, "sid").Value
+
+	sig := value[strings.LastIndexByte(value, '.'):]
+	for name, tampered := range map[string]string{
+		"unsigned":      first.ID(),
+		"other id":      strings.Repeat("A", len(first.ID())) + sig,
+		"bad signature": first.ID() + ".AAAA",
+		"other key":     signValue(NewHMACSigner([]byte("other")), first.ID()),
+	} {
+		rs, _ := startRequest(m, &http.Cookie{Name: "sid", Value: tampered})
+		if rs.ID() == first.ID() || rs.Has("user_id") {
+			t.Errorf("%s: the tampered cookie resumed the session", name)
+		}
+	}
+}
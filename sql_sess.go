@@ -0,0 +1,390 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sqlIdentifier matches the table names SQLProvider accepts, optionally schema qualified
+var sqlIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+type (
+	// SQLProvider stores sessions in a database table through database/sql, one row per
+	// session holding its encoded values and its expiry. Reads refresh the expiry, changes
+	// are written in a single UPDATE when the store is saved. The table must exist:
+	//
+	//	CREATE TABLE sessions (
+	//		sid        VARCHAR(255) PRIMARY KEY,
+	//		data       BLOB NOT NULL,   -- BYTEA on PostgreSQL
+	//		expires_at BIGINT NOT NULL  -- unix seconds, 0 if the session does not expire
+	//	);
+	//	CREATE INDEX sessions_expires_at ON sessions (expires_at);
+	//
+	// Register it to select it by name in Config.Provider:
+	//
+	//	session.RegisterProvider("sql", session.NewSQLProvider(db, nil))
+	SQLProvider struct {
+		db            *sql.DB
+		timeout       time.Duration
+		defaultMaxAge int64
+		codec         Codec
+		queries       sqlQueries
+
+		gcMu   sync.Mutex
+		gcDone chan struct{}
+	}
+
+	// SQLOptions configures a SQLProvider
+	SQLOptions struct {
+		// Table is the name of the sessions table, defaults to "sessions"
+		Table string
+		// Placeholder returns the bind parameter n, counting from 1, of the database dialect.
+		// defaults to "?" as used by MySQL and SQLite. For PostgreSQL use
+		//
+		//	func(n int) string { return "$" + strconv.Itoa(n) }
+		Placeholder func(n int) string
+		// Timeout bounds every query, defaults to 5 seconds
+		Timeout time.Duration
+		// DefaultMaxAge is the max age in seconds of sessions created by Regenerate
+		// when the old session is gone, defaults to 86400
+		DefaultMaxAge int64
+		// Codec serializes session values, defaults to GobCodec.
+		// Use an EncryptedCodec to encrypt sessions at rest
+		Codec Codec
+	}
+
+	// sqlQueries are the statements of a SQLProvider, built for its table and dialect
+	sqlQueries struct {
+		read, exists, insert, delete, touch, update, updateData, rename, gc string
+	}
+)
+
+// NewSQLProvider returns a provider storing sessions in db. opts may be nil to use the defaults.
+// panics if the table name is not a plain SQL identifier
+func NewSQLProvider(db *sql.DB, opts *SQLOptions) *SQLProvider {
+	p := &SQLProvider{
+		db:            db,
+		timeout:       5 * time.Second,
+		defaultMaxAge: 86400,
+		codec:         defaultCodec,
+	}
+
+	table := "sessions"
+	placeholder := func(n int) string { return "?" }
+
+	if opts != nil {
+		if opts.Table != "" {
+			table = opts.Table
+		}
+		if opts.Placeholder != nil {
+			placeholder = opts.Placeholder
+		}
+		if opts.Timeout > 0 {
+			p.timeout = opts.Timeout
+		}
+		if opts.DefaultMaxAge > 0 {
+			p.defaultMaxAge = opts.DefaultMaxAge
+		}
+		if opts.Codec != nil {
+			p.codec = opts.Codec
+		}
+	}
+
+	if !sqlIdentifier.MatchString(table) {
+		panic(fmt.Sprintf("session: SQL table name %q is not a valid identifier", table))
+	}
+
+	// query builds a statement, replacing each ? with the dialect placeholder
+	query := func(q string) string {
+		var b strings.Builder
+		n := 0
+		for _, part := range strings.Split(fmt.Sprintf(q, table), "?") {
+			if n > 0 {
+				b.WriteString(placeholder(n))
+			}
+			b.WriteString(part)
+			n++
+		}
+
+		return b.String()
+	}
+
+	p.queries = sqlQueries{
+		read:       query("SELECT data, expires_at FROM %s WHERE sid = ?"),
+		exists:     query("SELECT COUNT(*) FROM %s WHERE sid = ? AND (expires_at = 0 OR expires_at > ?)"),
+		insert:     query("INSERT INTO %s (sid, data, expires_at) VALUES (?, ?, ?)"),
+		delete:     query("DELETE FROM %s WHERE sid = ?"),
+		touch:      query("UPDATE %s SET expires_at = ? WHERE sid = ?"),
+		update:     query("UPDATE %s SET data = ?, expires_at = ? WHERE sid = ?"),
+		updateData: query("UPDATE %s SET data = ? WHERE sid = ?"),
+		rename:     query("UPDATE %s SET sid = ? WHERE sid = ?"),
+		gc:         query("DELETE FROM %s WHERE expires_at <> 0 AND expires_at <= ?"),
+	}
+
+	return p
+}
+
+// Read fetches the session from the database and refreshes its expiry.
+// If the session does not exist, has expired or can not be decoded or decrypted,
+// a new one is created and returned. If the query fails the error is logged and an
+// empty store is returned that is never saved, leaving the row as is
+func (p *SQLProvider) Read(sid string, maxAge int64) Store {
+	return p.ReadContext(context.Background(), sid, maxAge)
+}
+
+// ReadContext is like Read, bounding the queries by ctx as well as the provider timeout
+func (p *SQLProvider) ReadContext(ctx context.Context, sid string, maxAge int64) Store {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var data []byte
+	var expiresAt int64
+	err := p.db.QueryRowContext(ctx, p.queries.read, sid).Scan(&data, &expiresAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		// a failing database must not wipe the session, only this request goes without it
+		log.Printf("session: reading session: %v", err)
+		return newMemoryStore(sid, make(map[string]interface{}))
+	}
+	if err != nil || sqlExpired(expiresAt) {
+		return p.InitializeContext(ctx, sid, maxAge)
+	}
+
+	values, err := p.codec.Unmarshal(data)
+	if err != nil {
+		return p.InitializeContext(ctx, sid, maxAge)
+	}
+
+	if maxAge > 0 {
+		p.db.ExecContext(ctx, p.queries.touch, sqlExpiresAt(maxAge), sid)
+	}
+
+	return p.store(sid, values, maxAge)
+}
+
+// Initialize creates an empty session row expiring after maxAge seconds,
+// replacing any row left under sid
+func (p *SQLProvider) Initialize(sid string, maxAge int64) Store {
+	return p.InitializeContext(context.Background(), sid, maxAge)
+}
+
+// InitializeContext is like Initialize, bounding the queries by ctx
+func (p *SQLProvider) InitializeContext(ctx context.Context, sid string, maxAge int64) Store {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	store := p.store(sid, make(map[string]interface{}), maxAge)
+
+	data, err := p.codec.Marshal(map[string]interface{}{})
+	if err == nil {
+		err = p.inTx(ctx, func(tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, p.queries.delete, sid); err != nil {
+				return err
+			}
+
+			_, err := tx.ExecContext(ctx, p.queries.insert, sid, data, sqlExpiresAt(maxAge))
+			return err
+		})
+	}
+
+	if err != nil {
+		log.Printf("session: saving session: %v", err)
+	}
+
+	return store
+}
+
+// Exists checks if a session with passed id exists and has not expired
+func (p *SQLProvider) Exists(sid string) bool {
+	return p.ExistsContext(context.Background(), sid)
+}
+
+// ExistsContext is like Exists, bounding the query by ctx
+func (p *SQLProvider) ExistsContext(ctx context.Context, sid string) bool {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var n int
+	err := p.db.QueryRowContext(ctx, p.queries.exists, sid, time.Now().Unix()).Scan(&n)
+	return err == nil && n > 0
+}
+
+// Regenerate moves the session row to the new id in a transaction, keeping its values and expiry
+func (p *SQLProvider) Regenerate(oldsid string, sid string) Store {
+	return p.RegenerateContext(context.Background(), oldsid, sid)
+}
+
+// RegenerateContext is like Regenerate, bounding the queries by ctx
+func (p *SQLProvider) RegenerateContext(ctx context.Context, oldsid string, sid string) Store {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var values map[string]interface{}
+	err := p.inTx(ctx, func(tx *sql.Tx) error {
+		var data []byte
+		var expiresAt int64
+		if err := tx.QueryRowContext(ctx, p.queries.read, oldsid).Scan(&data, &expiresAt); err != nil {
+			return err
+		}
+
+		if sqlExpired(expiresAt) {
+			return sql.ErrNoRows
+		}
+
+		var err error
+		if values, err = p.codec.Unmarshal(data); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, p.queries.rename, sid, oldsid)
+		return err
+	})
+	if err != nil {
+		p.DestroyContext(ctx, oldsid)
+		return p.InitializeContext(ctx, sid, p.defaultMaxAge)
+	}
+
+	// the expiry is left as is, the next Read refreshes it
+	return p.store(sid, values, 0)
+}
+
+// Save writes the store to its row if it changed since it was read or last saved
+func (p *SQLProvider) Save(store Store) error {
+	return p.SaveContext(context.Background(), store)
+}
+
+// SaveContext is like Save, bounding the query by ctx
+func (p *SQLProvider) SaveContext(ctx context.Context, store Store) error {
+	return saveSynced(ctx, store)
+}
+
+// Touch pushes the expiry of the session back to maxAge seconds from now
+func (p *SQLProvider) Touch(sid string, maxAge int64) {
+	if maxAge <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	p.db.ExecContext(ctx, p.queries.touch, sqlExpiresAt(maxAge), sid)
+}
+
+// Destroy deletes the session row
+func (p *SQLProvider) Destroy(sid string) {
+	p.DestroyContext(context.Background(), sid)
+}
+
+// DestroyContext is like Destroy, bounding the query by ctx
+func (p *SQLProvider) DestroyContext(ctx context.Context, sid string) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	p.db.ExecContext(ctx, p.queries.delete, sid)
+}
+
+// GC deletes the rows of every session that has expired
+func (p *SQLProvider) GC() error {
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	_, err := p.db.ExecContext(ctx, p.queries.gc, time.Now().Unix())
+	return err
+}
+
+// StartGC starts a goroutine deleting expired sessions every interval,
+// replacing the collector started by a previous call
+func (p *SQLProvider) StartGC(interval time.Duration) {
+	p.StopGC()
+
+	p.gcMu.Lock()
+	defer p.gcMu.Unlock()
+
+	done := make(chan struct{})
+	p.gcDone = done
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.GC(); err != nil {
+					log.Printf("session: removing expired sessions: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// StopGC stops the collector started by StartGC, if any
+func (p *SQLProvider) StopGC() {
+	p.gcMu.Lock()
+	defer p.gcMu.Unlock()
+
+	if p.gcDone != nil {
+		close(p.gcDone)
+		p.gcDone = nil
+	}
+}
+
+// store returns a store saving its values to the row of sid. A positive maxAge
+// pushes the expiry back on every save, otherwise the expiry is left as is.
+// Saving never recreates a row destroyed meanwhile
+func (p *SQLProvider) store(sid string, values map[string]interface{}, maxAge int64) *syncedStore {
+	return newSyncedStore(sid, values, func(ctx context.Context, values map[string]interface{}, _ bool) error {
+		data, err := p.codec.Marshal(values)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+
+		if maxAge > 0 {
+			_, err = p.db.ExecContext(ctx, p.queries.update, data, sqlExpiresAt(maxAge), sid)
+		} else {
+			_, err = p.db.ExecContext(ctx, p.queries.updateData, data, sid)
+		}
+
+		return err
+	})
+}
+
+// inTx runs fn in a transaction, committed if fn returns nil
+func (p *SQLProvider) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// sqlExpiresAt returns the expires_at of a session with maxAge seconds left, 0 meaning none
+func sqlExpiresAt(maxAge int64) int64 {
+	if maxAge <= 0 {
+		return 0
+	}
+
+	return time.Now().Unix() + maxAge
+}
+
+// sqlExpired reports whether a session with expires_at has expired
+func sqlExpired(expiresAt int64) bool {
+	return expiresAt != 0 && expiresAt <= time.Now().Unix()
+}
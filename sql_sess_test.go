@@ -0,0 +1,283 @@
+package session
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// fakeSQL is an in-memory sessions table answering the statements of SQLProvider,
+// served through database/sql by fakeSQLDriver
+type fakeSQL struct {
+	mu   sync.Mutex
+	rows map[string]fakeSQLRow
+	// readErr, when set, fails the statement reading a row
+	readErr error
+}
+
+// fakeSQLRow is a row of the sessions table
+type fakeSQLRow struct {
+	data      []byte
+	expiresAt int64
+}
+
+var (
+	fakeSQLDBs   = map[string]*fakeSQL{}
+	fakeSQLDBsMu sync.Mutex
+	fakeSQLOnce  sync.Once
+)
+
+// newFakeSQL returns a database backed by a new fakeSQL
+func newFakeSQL(t *testing.T) (*fakeSQL, *sql.DB) {
+	t.Helper()
+
+	fakeSQLOnce.Do(func() { sql.Register("sessiontest", fakeSQLDriver{}) })
+
+	f := &fakeSQL{rows: make(map[string]fakeSQLRow)}
+	fakeSQLDBsMu.Lock()
+	name := strconv.Itoa(len(fakeSQLDBs))
+	fakeSQLDBs[name] = f
+	fakeSQLDBsMu.Unlock()
+
+	db, err := sql.Open("sessiontest", name)
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	return f, db
+}
+
+// setReadErr makes the statement reading a row fail with err, or succeed again if nil
+func (f *fakeSQL) setReadErr(err error) {
+	f.mu.Lock()
+	f.readErr = err
+	f.mu.Unlock()
+}
+
+// exec runs a statement of SQLProvider against the table
+func (f *fakeSQL) exec(query string, args []driver.Value) (int64, [][]driver.Value, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	str := func(i int) string { return args[i].(string) }
+	num := func(i int) int64 { return args[i].(int64) }
+	bytes := func(i int) []byte { return append([]byte(nil), args[i].([]byte)...) }
+
+	switch query {
+	case "SELECT data, expires_at FROM sessions WHERE sid = ?":
+		if f.readErr != nil {
+			return 0, nil, f.readErr
+		}
+		row, ok := f.rows[str(0)]
+		if !ok {
+			return 0, nil, nil
+		}
+		return 0, [][]driver.Value{{row.data, row.expiresAt}}, nil
+
+	case "SELECT COUNT(*) FROM sessions WHERE sid = ? AND (expires_at = 0 OR expires_at > ?)":
+		n := int64(0)
+		if row, ok := f.rows[str(0)]; ok && (row.expiresAt == 0 || row.expiresAt > num(1)) {
+			n = 1
+		}
+		return 0, [][]driver.Value{{n}}, nil
+
+	case "INSERT INTO sessions (sid, data, expires_at) VALUES (?, ?, ?)":
+		if _, ok := f.rows[str(0)]; ok {
+			return 0, nil, fmt.Errorf("duplicate sid %q", str(0))
+		}
+		f.rows[str(0)] = fakeSQLRow{data: bytes(1), expiresAt: num(2)}
+		return 1, nil, nil
+
+	case "DELETE FROM sessions WHERE sid = ?":
+		if _, ok := f.rows[str(0)]; !ok {
+			return 0, nil, nil
+		}
+		delete(f.rows, str(0))
+		return 1, nil, nil
+
+	case "UPDATE sessions SET expires_at = ? WHERE sid = ?":
+		return f.update(str(1), func(row *fakeSQLRow) { row.expiresAt = num(0) }), nil, nil
+
+	case "UPDATE sessions SET data = ?, expires_at = ? WHERE sid = ?":
+		return f.update(str(2), func(row *fakeSQLRow) { row.data, row.expiresAt = bytes(0), num(1) }), nil, nil
+
+	case "UPDATE sessions SET data = ? WHERE sid = ?":
+		return f.update(str(1), func(row *fakeSQLRow) { row.data = bytes(0) }), nil, nil
+
+	case "UPDATE sessions SET sid = ? WHERE sid = ?":
+		row, ok := f.rows[str(1)]
+		if !ok {
+			return 0, nil, nil
+		}
+		delete(f.rows, str(1))
+		f.rows[str(0)] = row
+		return 1, nil, nil
+
+	case "DELETE FROM sessions WHERE expires_at <> 0 AND expires_at <= ?":
+		n := int64(0)
+		for sid, row := range f.rows {
+			if row.expiresAt != 0 && row.expiresAt <= num(0) {
+				delete(f.rows, sid)
+				n++
+			}
+		}
+		return n, nil, nil
+	}
+
+	return 0, nil, fmt.Errorf("fakeSQL: unexpected query %q", query)
+}
+
+// update applies fn to the row of sid, the caller must hold the lock
+func (f *fakeSQL) update(sid string, fn func(row *fakeSQLRow)) int64 {
+	row, ok := f.rows[sid]
+	if !ok {
+		return 0
+	}
+
+	fn(&row)
+	f.rows[sid] = row
+	return 1
+}
+
+// fakeSQLDriver opens connections to the fakeSQL named by the data source name
+type fakeSQLDriver struct{}
+
+func (fakeSQLDriver) Open(name string) (driver.Conn, error) {
+	fakeSQLDBsMu.Lock()
+	defer fakeSQLDBsMu.Unlock()
+
+	f, ok := fakeSQLDBs[name]
+	if !ok {
+		return nil, fmt.Errorf("fakeSQL: no database %q", name)
+	}
+
+	return fakeSQLConn{f}, nil
+}
+
+// fakeSQLConn is a connection to a fakeSQL. Transactions are not isolated,
+// statements apply as they run
+type fakeSQLConn struct {
+	db *fakeSQL
+}
+
+func (c fakeSQLConn) Prepare(query string) (driver.Stmt, error) {
+	return fakeSQLStmt{db: c.db, query: query}, nil
+}
+
+func (c fakeSQLConn) Close() error { return nil }
+
+func (c fakeSQLConn) Begin() (driver.Tx, error) { return fakeSQLTx{}, nil }
+
+// fakeSQLTx is a transaction of a fakeSQLConn
+type fakeSQLTx struct{}
+
+func (fakeSQLTx) Commit() error   { return nil }
+func (fakeSQLTx) Rollback() error { return nil }
+
+// fakeSQLStmt is a statement prepared on a fakeSQLConn
+type fakeSQLStmt struct {
+	db    *fakeSQL
+	query string
+}
+
+func (s fakeSQLStmt) Close() error  { return nil }
+func (s fakeSQLStmt) NumInput() int { return -1 }
+
+func (s fakeSQLStmt) Exec(args []driver.Value) (driver.Result, error) {
+	n, _, err := s.db.exec(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return driver.RowsAffected(n), nil
+}
+
+func (s fakeSQLStmt) Query(args []driver.Value) (driver.Rows, error) {
+	_, rows, err := s.db.exec(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fakeSQLRows{rows: rows}, nil
+}
+
+// fakeSQLRows iterates over the result of a query
+type fakeSQLRows struct {
+	rows [][]driver.Value
+}
+
+func (r *fakeSQLRows) Columns() []string {
+	if len(r.rows) > 0 && len(r.rows[0]) == 1 {
+		return []string{"count"}
+	}
+
+	return []string{"data", "expires_at"}
+}
+
+func (r *fakeSQLRows) Close() error { return nil }
+
+func (r *fakeSQLRows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func TestSQLProviderRegenerateReload(t *testing.T) {
+	_, db := newFakeSQL(t)
+	testRegenerateReload(t, func() Provider { return NewSQLProvider(db, nil) })
+}
+
+func TestSQLProviderSaveAfterDestroy(t *testing.T) {
+	_, db := newFakeSQL(t)
+	testSaveAfterDestroy(t, NewSQLProvider(db, nil))
+}
+
+func TestSQLProviderReadErrorKeepsTheRow(t *testing.T) {
+	f, db := newFakeSQL(t)
+	p := NewSQLProvider(db, nil)
+
+	store := p.Initialize("sid1", 3600)
+	store.Set("user_id", 42)
+	if err := p.Save(store); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	f.setReadErr(errors.New("connection reset"))
+	failed := p.Read("sid1", 3600)
+	if failed.Has("user_id") {
+		t.Error("the failed read returned the values")
+	}
+
+	failed.Set("user_id", 7)
+	if err := p.Save(failed); err != nil {
+		t.Errorf("Save of the failed read: %v", err)
+	}
+
+	f.setReadErr(nil)
+	if data, _ := p.Read("sid1", 3600).Get("user_id"); data != 42 {
+		t.Errorf("user_id = %v once the database recovered, want 42", data)
+	}
+}
+
+func TestSQLProviderReadMissCreatesTheRow(t *testing.T) {
+	_, db := newFakeSQL(t)
+	p := NewSQLProvider(db, nil)
+
+	store := p.Read("sid1", 3600)
+	if store.Len() != 0 {
+		t.Errorf("new session holds %d items", store.Len())
+	}
+	if !p.Exists("sid1") {
+		t.Error("no row was created for the missing session")
+	}
+}
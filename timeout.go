@@ -0,0 +1,59 @@
+package session
+
+import "time"
+
+const (
+	// createdKey is the reserved store key holding when the session was created, in unix seconds
+	createdKey = "_session.created"
+	// accessedKey is the reserved store key holding when the session was last used, in unix seconds
+	accessedKey = "_session.accessed"
+	// rotatedKey is the reserved store key holding when Renew last moved the session to a new id, in unix seconds
+	rotatedKey = "_session.rotated"
+)
+
+// stamp records the creation and first use of a new session for the configured timeouts
+func (s *Session) stamp(now int64) {
+	if s.config.AbsoluteTimeout > 0 {
+		s.store.Set(createdKey, now)
+	}
+	if s.config.IdleTimeout > 0 {
+		s.store.Set(accessedKey, now)
+	}
+}
+
+// timedOut reports whether the session exceeded its idle or absolute timeout at now
+func (s *Session) timedOut(now int64) bool {
+	if s.config.AbsoluteTimeout > 0 {
+		if created, ok := s.store.Get(createdKey); ok && elapsed(created, now) >= s.config.AbsoluteTimeout {
+			return true
+		}
+	}
+
+	if s.config.IdleTimeout > 0 {
+		if accessed, ok := s.store.Get(accessedKey); ok && elapsed(accessed, now) >= s.config.IdleTimeout {
+			return true
+		}
+	}
+
+	return false
+}
+
+// recordAccess records the use of the session at now. Sessions created before a timeout
+// was configured start their timers at their first use
+func (s *Session) recordAccess(now int64) {
+	if s.config.AbsoluteTimeout > 0 && !s.store.Has(createdKey) {
+		s.store.Set(createdKey, now)
+	}
+
+	if s.config.IdleTimeout > 0 {
+		if accessed, ok := s.store.Get(accessedKey); !ok || accessed != now {
+			s.store.Set(accessedKey, now)
+		}
+	}
+}
+
+// elapsed returns the time from the unix seconds stamp to now
+func elapsed(stamp interface{}, now int64) time.Duration {
+	at, _ := stamp.(int64)
+	return time.Duration(now-at) * time.Second
+}
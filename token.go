@@ -0,0 +1,81 @@
+package session
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// tokenSource is a place of the request to look the session id up, see Config.TokenLookup
+type tokenSource struct {
+	kind string // "cookie", "header" or "query"
+	name string
+}
+
+// parseTokenLookup parses a comma-separated list of sources, "cookie:" + key if lookup is empty
+func parseTokenLookup(lookup, key string) ([]tokenSource, error) {
+	if lookup == "" {
+		return []tokenSource{{kind: "cookie", name: key}}, nil
+	}
+
+	var sources []tokenSource
+	for _, entry := range strings.Split(lookup, ",") {
+		kind, name, _ := strings.Cut(strings.TrimSpace(entry), ":")
+		switch kind {
+		case "cookie":
+			if name == "" {
+				name = key
+			}
+			if name != key {
+				return nil, fmt.Errorf("session: TokenLookup cookie %q differs from Key %q", name, key)
+			}
+		case "header", "query":
+			if name == "" {
+				return nil, fmt.Errorf("session: TokenLookup %s source %q has no name", kind, entry)
+			}
+		default:
+			return nil, fmt.Errorf("session: TokenLookup source %q is not cookie, header or query", entry)
+		}
+
+		sources = append(sources, tokenSource{kind: kind, name: name})
+	}
+
+	return sources, nil
+}
+
+// lookupToken returns the session id of the first valid token found in the configured
+// sources and whether it came from the cookie. Malformed tokens and tokens with an invalid
+// signature are skipped, so that a bad header does not hide a valid cookie. Without token,
+// fromCookie reports whether a cookie source is configured, that is whether a new session
+// gets a cookie
+func (s *Session) lookupToken(req *http.Request) (sid string, fromCookie bool) {
+	sources := s.config.tokenSources
+	if sources == nil {
+		sources = []tokenSource{{kind: "cookie", name: s.config.Key}}
+	}
+
+	for _, src := range sources {
+		var value string
+		switch src.kind {
+		case "cookie":
+			fromCookie = true
+			value = s.cookieCodec().Read(src.name, req)
+		case "header":
+			value = req.Header.Get(src.name)
+			if len(value) > len("Bearer ") && strings.EqualFold(value[:len("Bearer ")], "Bearer ") {
+				value = value[len("Bearer "):]
+			}
+		case "query":
+			value = req.URL.Query().Get(src.name)
+		}
+
+		if value == "" {
+			continue
+		}
+		if sid, ok := s.parseToken(value); ok {
+			return sid, src.kind == "cookie"
+		}
+	}
+
+	return "", fromCookie
+}
@@ -0,0 +1,38 @@
+package session
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLookupTokenSkipsMalformedHeader(t *testing.T) {
+	m := newTestManager(t, nil, func(cfg *Config) {
+		cfg.TokenLookup = "header:Authorization,cookie:sid"
+	})
+
+	s, w := startRequest(m)
+	s.Set("user", "alice")
+	if err := s.Commit(w); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	cookie := responseCookie(w, "sid")
+	if cookie == nil {
+		t.Fatal("no session cookie on a header-plus-cookie lookup")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer not;a;token")
+	req.AddCookie(cookie)
+	resumed := m.Start(httptest.NewRecorder(), req)
+
+	if resumed.ID() != s.ID() {
+		t.Fatalf("ID() = %q, want the cookie session %q", resumed.ID(), s.ID())
+	}
+	if user, _ := resumed.GetString("user"); user != "alice" {
+		t.Fatalf("user = %q, want alice", user)
+	}
+	if resumed.cookieless {
+		t.Fatal("session resumed from the cookie is cookieless")
+	}
+}
@@ -0,0 +1,105 @@
+package session
+
+import "time"
+
+// ttlKey is the reserved store key holding the expiry, in unix nanoseconds, of items set with SetWithTTL
+const ttlKey = "_session.ttl"
+
+// SetWithTTL adds an item to session store that expires after ttl, e.g. a short lived token.
+// Once expired, the item reads as missing and is removed. Setting the key again with Set
+// makes it live as long as the session
+func (s *Session) SetWithTTL(key string, data interface{}, ttl time.Duration) {
+	if !s.writable() {
+		return
+	}
+
+	expiresAt := time.Now().Add(ttl).UnixNano()
+	s.store.Transaction(func(tx *Tx) error {
+		expiries := copyExpiries(tx)
+		expiries[key] = expiresAt
+
+		tx.Set(key, data)
+		tx.Set(ttlKey, expiries)
+		return nil
+	})
+}
+
+// expireKey reports whether the TTL of key has passed, removing the item if so
+func (s *Session) expireKey(key string) bool {
+	if !s.keyExpired(key, time.Now().UnixNano()) {
+		return false
+	}
+
+	s.store.Transaction(func(tx *Tx) error {
+		if expiresAt, ok := copyExpiries(tx)[key]; !ok || expiresAt > time.Now().UnixNano() {
+			return nil // set again meanwhile
+		}
+
+		tx.Remove(key)
+		clearExpiries(tx, key)
+		return nil
+	})
+
+	return true
+}
+
+// keyExpired reports whether key has a TTL that has passed at now
+func (s *Session) keyExpired(key string, now int64) bool {
+	data, ok := s.store.Get(ttlKey)
+	if !ok {
+		return false
+	}
+
+	expiresAt, ok := data.(map[string]int64)[key]
+	return ok && expiresAt <= now
+}
+
+// hasTTL reports whether any of keys has a TTL
+func (s *Session) hasTTL(keys ...string) bool {
+	data, ok := s.store.Get(ttlKey)
+	if !ok {
+		return false
+	}
+
+	expiries, _ := data.(map[string]int64)
+	for _, key := range keys {
+		if _, ok := expiries[key]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clearExpiries stages the removal of the TTL of keys on tx
+func clearExpiries(tx *Tx, keys ...string) {
+	expiries := copyExpiries(tx)
+	for _, key := range keys {
+		delete(expiries, key)
+	}
+
+	setExpiries(tx, expiries)
+}
+
+// copyExpiries returns a copy of the item expiries as seen by tx
+func copyExpiries(tx *Tx) map[string]int64 {
+	data, _ := tx.Get(ttlKey)
+	current, _ := data.(map[string]int64)
+
+	expiries := make(map[string]int64, len(current)+1)
+	for key, expiresAt := range current {
+		expiries[key] = expiresAt
+	}
+
+	return expiries
+}
+
+// setExpiries stages expiries on tx, removing the reserved key once empty
+func setExpiries(tx *Tx, expiries map[string]int64) {
+	if len(expiries) == 0 {
+		tx.Remove(ttlKey)
+		return
+	}
+
+	tx.Set(ttlKey, expiries)
+}
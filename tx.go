@@ -0,0 +1,52 @@
+package session
+
+// Tx holds changes to a store that are applied together, see Session.Transaction
+type Tx struct {
+	read    func(key string) (interface{}, bool)
+	changes map[string]txChange
+}
+
+// txChange is a pending write or removal of a single key
+type txChange struct {
+	data    interface{}
+	removed bool
+}
+
+func newTx(read func(key string) (interface{}, bool)) *Tx {
+	return &Tx{read: read, changes: make(map[string]txChange)}
+}
+
+// Get returns an item as seen by the transaction, including its own pending changes
+func (tx *Tx) Get(key string) (interface{}, bool) {
+	data, ok := tx.read(key)
+	if change, changed := tx.changes[key]; changed {
+		data, ok = change.data, !change.removed
+	}
+
+	if c, isComputed := data.(*computedValue); isComputed {
+		return c.get(), ok
+	}
+
+	return data, ok
+}
+
+// Set stages an item to be put into the session on commit
+func (tx *Tx) Set(key string, data interface{}) {
+	tx.changes[key] = txChange{data: data}
+}
+
+// Remove stages an item to be removed from the session on commit
+func (tx *Tx) Remove(key string) {
+	tx.changes[key] = txChange{removed: true}
+}
+
+// Transaction runs fn with a Tx and applies all of its changes at once if fn returns nil.
+// If fn returns an error the changes are discarded and the error returned.
+// The store is write locked for the duration of fn, so fn should not block
+func (s *Session) Transaction(fn func(tx *Tx) error) error {
+	if err := s.writeErr(); err != nil {
+		return err
+	}
+
+	return s.store.Transaction(fn)
+}
@@ -0,0 +1,101 @@
+package session
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestTransactionCommit(t *testing.T) {
+	rs, _ := startRequest(newTestManager(t, nil, nil))
+	rs.SetMany(map[string]interface{}{"from": 100, "to": 0, "pending": true})
+
+	err := rs.Transaction(func(tx *Tx) error {
+		from, _ := tx.Get("from")
+		to, _ := tx.Get("to")
+		tx.Set("from", from.(int)-30)
+		tx.Set("to", to.(int)+30)
+		tx.Remove("pending")
+
+		if data, _ := tx.Get("from"); data != 70 {
+			t.Errorf("tx.Get(from) = %v, want its pending change 70", data)
+		}
+		if _, ok := tx.Get("pending"); ok {
+			t.Error("tx.Get found the pending removal")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction: %v", err)
+	}
+
+	from, _ := rs.Get("from")
+	to, _ := rs.Get("to")
+	if from != 70 || to != 30 || rs.Has("pending") {
+		t.Errorf("from = %v, to = %v, pending kept %v; want 70, 30 and removed", from, to, rs.Has("pending"))
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	rs, _ := startRequest(newTestManager(t, nil, nil))
+	rs.SetMany(map[string]interface{}{"from": 100, "to": 0})
+
+	failed := errors.New("insufficient funds")
+	err := rs.Transaction(func(tx *Tx) error {
+		tx.Set("from", -100)
+		tx.Set("to", 200)
+		tx.Remove("from")
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("Transaction = %v, want the error of fn", err)
+	}
+
+	from, _ := rs.Get("from")
+	to, _ := rs.Get("to")
+	if from != 100 || to != 0 {
+		t.Errorf("from = %v, to = %v after the rollback, want 100 and 0", from, to)
+	}
+}
+
+func TestTransactionIsolation(t *testing.T) {
+	rs, _ := startRequest(newTestManager(t, nil, nil))
+	rs.SetMany(map[string]interface{}{"from": 1000, "to": 0})
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+
+			values := rs.Snapshot()
+			if sum := values["from"].(int) + values["to"].(int); sum != 1000 {
+				t.Errorf("a reader saw from + to = %d, want 1000", sum)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		rs.Transaction(func(tx *Tx) error {
+			from, _ := tx.Get("from")
+			to, _ := tx.Get("to")
+			tx.Set("from", from.(int)-1)
+			tx.Set("to", to.(int)+1)
+			return nil
+		})
+	}
+	close(stop)
+	wg.Wait()
+
+	if data, _ := rs.Get("to"); data != 200 {
+		t.Errorf("to = %v, want 200", data)
+	}
+}